@@ -6,3 +6,58 @@ CREATE TABLE users (
    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
    name TEXT NOT NULL
 );
+
+CREATE TABLE idempotency_keys (
+   key TEXT PRIMARY KEY,
+   fingerprint TEXT NOT NULL,
+   status_code INTEGER,
+   response_headers BYTEA,
+   response_body BYTEA,
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+
+CREATE TABLE feature_flags (
+   name TEXT PRIMARY KEY,
+   description TEXT NOT NULL DEFAULT '',
+   enabled BOOLEAN NOT NULL DEFAULT FALSE,
+   rollout INTEGER NOT NULL DEFAULT 0 CHECK (rollout BETWEEN 0 AND 100),
+   users TEXT[] NOT NULL DEFAULT '{}',
+   roles TEXT[] NOT NULL DEFAULT '{}',
+   updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE audit_events (
+   id BIGSERIAL PRIMARY KEY,
+   occurred_at TIMESTAMP NOT NULL,
+   actor TEXT NOT NULL,
+   action TEXT NOT NULL,
+   target TEXT NOT NULL DEFAULT '',
+   outcome TEXT NOT NULL,
+   ip TEXT NOT NULL DEFAULT '',
+   request_id TEXT NOT NULL DEFAULT '',
+   details JSON NOT NULL DEFAULT '{}',
+   prev_hash TEXT NOT NULL,
+   hash TEXT NOT NULL UNIQUE
+);
+
+CREATE INDEX audit_events_actor_idx ON audit_events (actor, id);
+CREATE INDEX audit_events_action_idx ON audit_events (action, id);
+CREATE INDEX audit_events_occurred_at_idx ON audit_events (occurred_at);
+
+-- Rows can only be appended, any update, delete or truncate is rejected
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+   RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_update_delete
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+BEFORE TRUNCATE ON audit_events
+FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,276 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/logger"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionSignIn        = "auth.sign_in"
+	ActionSignOut       = "auth.sign_out"
+	ActionTokenRejected = "auth.token_rejected"
+	ActionUserCreate    = "user.create"
+	ActionFileUpload    = "file.upload"
+	ActionMaintenance   = "admin.maintenance"
+	ActionFeatureFlag   = "admin.feature_flag"
+	ActionLogLevel      = "admin.log_level"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Anonymous is the actor of events from unauthenticated requests
+const Anonymous = "anonymous"
+
+const (
+	defaultQueueSize = 1024
+	writeTimeout     = 5 * time.Second
+	criticalWait     = 5 * time.Second
+	verifyBatchSize  = 500
+	DefaultLimit     = 100
+	MaxLimit         = 1000
+)
+
+type Config struct {
+	QueueSize int `yaml:"queue_size"` // events waiting to be written, further events are dropped unless critical
+}
+
+// Event is one entry of the audit log. Each event stores the hash of the
+// one before it, so editing or removing an event breaks the chain.
+type Event struct {
+	ID         int64             `json:"id"`
+	OccurredAt time.Time         `json:"occurred_at"`
+	Actor      string            `json:"actor"` // user ID, or Anonymous
+	Action     string            `json:"action"`
+	Target     string            `json:"target,omitempty"` // what the action applied to
+	Outcome    string            `json:"outcome"`
+	IP         string            `json:"ip,omitempty"`
+	RequestID  string            `json:"request_id,omitempty"`
+	Details    map[string]string `json:"details,omitempty"`
+	PrevHash   string            `json:"prev_hash"`
+	Hash       string            `json:"hash"`
+}
+
+// Chain links e to the event whose hash is prev, an empty prev starts the
+// chain. Stores call it while holding the lock that orders appends.
+func (e *Event) Chain(prev string) {
+	// Keep what the database can store so the hash can be recomputed
+	e.OccurredAt = e.OccurredAt.UTC().Truncate(time.Microsecond)
+	if e.Details == nil {
+		e.Details = map[string]string{}
+	}
+	e.PrevHash = prev
+	e.Hash = e.digest()
+}
+
+// digest hashes every field except the ID, which is assigned by the store
+func (e *Event) digest() string {
+	payload, _ := json.Marshal([]any{
+		e.OccurredAt.UTC().Format(time.RFC3339Nano),
+		e.Actor,
+		e.Action,
+		e.Target,
+		e.Outcome,
+		e.IP,
+		e.RequestID,
+		e.Details,
+		e.PrevHash,
+	})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// Filter selects events, zero fields match everything
+type Filter struct {
+	Actor    string
+	Action   string
+	Since    time.Time // inclusive
+	Until    time.Time // exclusive
+	BeforeID int64     // for paging, pass the ID of the last event of the previous page
+	Limit    int
+}
+
+// Store persists events. Append must chain each event to the latest one
+// while no other writer, in this or any other instance, can append.
+type Store interface {
+	Append(ctx context.Context, event Event) (Event, error)
+	// List returns the events matching filter, newest first
+	List(ctx context.Context, filter Filter) ([]Event, error)
+	// ListAfter returns up to limit events with an ID above afterID, oldest first
+	ListAfter(ctx context.Context, afterID int64, limit int) ([]Event, error)
+}
+
+// Log writes events to a Store in the background so requests never wait on
+// the database. When the queue is full, events are dropped and counted in
+// audit_events_dropped_total, except critical ones, which wait for room.
+type Log struct {
+	store        Store
+	queue        chan Event
+	done         chan struct{}
+	criticalWait time.Duration
+
+	mu     sync.RWMutex // guards closed against sends on a closed queue
+	closed bool
+}
+
+func NewLog(store Store, config *Config) *Log {
+	size := defaultQueueSize
+	if config != nil && config.QueueSize > 0 {
+		size = config.QueueSize
+	}
+	l := &Log{
+		store:        store,
+		queue:        make(chan Event, size),
+		done:         make(chan struct{}),
+		criticalWait: criticalWait,
+	}
+	go l.write()
+	return l
+}
+
+func (l *Log) write() {
+	defer close(l.done)
+	for event := range l.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+		_, err := l.store.Append(ctx, event)
+		cancel()
+		if err != nil {
+			monitoring.AuditWriteErrorsTotal.Inc()
+			logger.Error("Failed to write audit event %s by %s on %q: %v", event.Action, event.Actor, event.Target, err)
+		}
+	}
+}
+
+// critical reports whether action must not be dropped when the queue is
+// full: sign-ins and admin changes
+func critical(action string) bool {
+	return action == ActionSignIn || strings.HasPrefix(action, "admin.")
+}
+
+// Record queues event, OccurredAt defaults to now. A critical event waits up
+// to criticalWait for room in a full queue, so the request recording it is
+// slowed down rather than the event lost.
+func (l *Log) Record(event Event) {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		monitoring.AuditEventsDroppedTotal.Inc()
+		return
+	}
+	select {
+	case l.queue <- event:
+		return
+	default:
+	}
+	if critical(event.Action) {
+		timer := time.NewTimer(l.criticalWait)
+		defer timer.Stop()
+		select {
+		case l.queue <- event:
+			return
+		case <-timer.C:
+		}
+	}
+	monitoring.AuditEventsDroppedTotal.Inc()
+	logger.Error("Audit queue full, dropped event %s by %s on %q", event.Action, event.Actor, event.Target)
+}
+
+// Events returns the events matching filter, newest first. The limit
+// defaults to DefaultLimit and is capped at MaxLimit.
+func (l *Log) Events(ctx context.Context, filter Filter) ([]Event, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultLimit
+	}
+	filter.Limit = min(filter.Limit, MaxLimit)
+	return l.store.List(ctx, filter)
+}
+
+// Verification is the result of walking the hash chain
+type Verification struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	BrokenAt int64  `json:"broken_at,omitempty"` // ID of the first event that does not match
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Verify recomputes every hash from the oldest event and checks each event
+// points at the one before it. Events removed from the end of the log
+// cannot be detected this way.
+func (l *Log) Verify(ctx context.Context) (Verification, error) {
+	result := Verification{Valid: true}
+	prev := ""
+	var afterID int64
+	for {
+		events, err := l.store.ListAfter(ctx, afterID, verifyBatchSize)
+		if err != nil {
+			return result, err
+		}
+		for _, event := range events {
+			switch {
+			case event.PrevHash != prev:
+				result.Reason = "previous hash does not match the event before it"
+			case event.digest() != event.Hash:
+				result.Reason = "hash does not match the event contents"
+			}
+			if result.Reason != "" {
+				result.Valid = false
+				result.BrokenAt = event.ID
+				return result, nil
+			}
+			result.Checked++
+			prev = event.Hash
+			afterID = event.ID
+		}
+		if len(events) < verifyBatchSize {
+			return result, nil
+		}
+	}
+}
+
+// Close stops accepting events and waits until the queued ones are written
+func (l *Log) Close(ctx context.Context) error {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.queue)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("audit events not written before shutdown: %w", ctx.Err())
+	}
+}
+
+var std atomic.Pointer[Log]
+
+// SetDefault makes l the log Record writes to
+func SetDefault(l *Log) {
+	std.Store(l)
+}
+
+// Record queues event on the default log, it is dropped if there is none
+func Record(event Event) {
+	if l := std.Load(); l != nil {
+		l.Record(event)
+	}
+}
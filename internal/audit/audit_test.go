@@ -0,0 +1,243 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore chains events like PostgresStore, under a mutex
+type memoryStore struct {
+	mu     sync.Mutex
+	events []Event
+	block  chan struct{} // when set, Append waits until it is closed
+}
+
+func (s *memoryStore) Append(ctx context.Context, event Event) (Event, error) {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := ""
+	if len(s.events) > 0 {
+		prev = s.events[len(s.events)-1].Hash
+	}
+	event.Chain(prev)
+	event.ID = int64(len(s.events) + 1)
+	s.events = append(s.events, event)
+	return event, nil
+}
+
+func (s *memoryStore) List(ctx context.Context, filter Filter) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []Event
+	for i := len(s.events) - 1; i >= 0 && len(events) < filter.Limit; i-- {
+		event := s.events[i]
+		if (filter.Actor == "" || event.Actor == filter.Actor) && (filter.Action == "" || event.Action == filter.Action) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (s *memoryStore) ListAfter(ctx context.Context, afterID int64, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []Event
+	for _, event := range s.events {
+		if event.ID > afterID && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// record writes n sign-in events through a Log and closes it
+func record(t *testing.T, store *memoryStore, n int) *Log {
+	t.Helper()
+	l := NewLog(store, nil)
+	for i := 0; i < n; i++ {
+		l.Record(Event{
+			Actor:   "ama",
+			Action:  ActionSignIn,
+			Outcome: OutcomeSuccess,
+			Details: map[string]string{"attempt": string(rune('a' + i))},
+		})
+	}
+	if err := l.Close(context.Background()); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	return l
+}
+
+func TestRecordChainsEvents(t *testing.T) {
+	store := &memoryStore{}
+	record(t, store, 3)
+
+	if len(store.events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(store.events))
+	}
+	if store.events[0].PrevHash != "" {
+		t.Errorf("first event should start the chain, got prev hash %q", store.events[0].PrevHash)
+	}
+	for i := 1; i < len(store.events); i++ {
+		if store.events[i].PrevHash != store.events[i-1].Hash {
+			t.Errorf("event %d does not point at the event before it", i)
+		}
+	}
+	if store.events[0].OccurredAt.IsZero() || store.events[0].OccurredAt.Location() != time.UTC {
+		t.Errorf("OccurredAt should default to now in UTC, got %v", store.events[0].OccurredAt)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		tamper   func(events []Event) []Event
+		valid    bool
+		brokenAt int64
+	}{
+		{
+			name:   "Untouched",
+			tamper: func(events []Event) []Event { return events },
+			valid:  true,
+		},
+		{
+			name: "Edited Details",
+			tamper: func(events []Event) []Event {
+				events[1].Details = map[string]string{"attempt": "z"}
+				return events
+			},
+			brokenAt: 2,
+		},
+		{
+			name: "Edited Actor And Rehashed",
+			tamper: func(events []Event) []Event {
+				events[1].Actor = "mallory"
+				events[1].Hash = events[1].digest()
+				return events
+			},
+			brokenAt: 3,
+		},
+		{
+			name: "Removed Event",
+			tamper: func(events []Event) []Event {
+				return append(events[:1], events[2:]...)
+			},
+			brokenAt: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryStore{}
+			l := record(t, store, 4)
+			store.events = tt.tamper(store.events)
+
+			result, err := l.Verify(context.Background())
+			if err != nil {
+				t.Fatalf("Verify returned error: %v", err)
+			}
+			if result.Valid != tt.valid || result.BrokenAt != tt.brokenAt {
+				t.Errorf("wrong result: got valid=%v broken_at=%d want valid=%v broken_at=%d (%s)",
+					result.Valid, result.BrokenAt, tt.valid, tt.brokenAt, result.Reason)
+			}
+			if tt.valid && result.Checked != 4 {
+				t.Errorf("wrong number of events checked: got %d want 4", result.Checked)
+			}
+		})
+	}
+}
+
+func TestRecordDropsWhenQueueFull(t *testing.T) {
+	store := &memoryStore{block: make(chan struct{})}
+	l := NewLog(store, &Config{QueueSize: 1})
+
+	// The writer holds the first event, the queue the second, the rest are dropped
+	for i := 0; i < 5; i++ {
+		l.Record(Event{Actor: Anonymous, Action: ActionTokenRejected, Outcome: OutcomeFailure})
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(store.block)
+	if err := l.Close(context.Background()); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if len(store.events) != 2 {
+		t.Errorf("expected 2 events written, got %d", len(store.events))
+	}
+
+	// Recording after Close must not panic
+	l.Record(Event{Actor: "ama", Action: ActionSignOut, Outcome: OutcomeSuccess})
+}
+
+func TestRecordWaitsForCriticalEvents(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   string
+		wait     time.Duration
+		expected int
+	}{
+		{name: "Sign In", action: ActionSignIn, wait: time.Second, expected: 3},
+		{name: "Admin Change", action: ActionMaintenance, wait: time.Second, expected: 3},
+		{name: "Other Action", action: ActionTokenRejected, wait: time.Second, expected: 2},
+		{name: "Wait Exceeded", action: ActionSignIn, wait: time.Millisecond, expected: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryStore{block: make(chan struct{})}
+			l := NewLog(store, &Config{QueueSize: 1})
+			l.criticalWait = tt.wait
+
+			// Fill the writer and the queue
+			l.Record(Event{Actor: Anonymous, Action: ActionTokenRejected, Outcome: OutcomeFailure})
+			time.Sleep(5 * time.Millisecond)
+			l.Record(Event{Actor: Anonymous, Action: ActionTokenRejected, Outcome: OutcomeFailure})
+
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				close(store.block)
+			}()
+			l.Record(Event{Actor: "ama", Action: tt.action, Outcome: OutcomeSuccess})
+			if err := l.Close(context.Background()); err != nil {
+				t.Fatalf("Close returned error: %v", err)
+			}
+			if len(store.events) != tt.expected {
+				t.Errorf("wrong number of events written: got %d want %d", len(store.events), tt.expected)
+			}
+		})
+	}
+}
+
+func TestEventsLimit(t *testing.T) {
+	store := &memoryStore{}
+	l := record(t, store, 3)
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected int
+	}{
+		{name: "Default Limit", filter: Filter{}, expected: 3},
+		{name: "Limit", filter: Filter{Limit: 2}, expected: 2},
+		{name: "Actor", filter: Filter{Actor: "kofi"}, expected: 0},
+		{name: "Action", filter: Filter{Action: ActionSignIn, Limit: MaxLimit * 2}, expected: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := l.Events(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("Events returned error: %v", err)
+			}
+			if len(events) != tt.expected {
+				t.Errorf("wrong number of events: got %d want %d", len(events), tt.expected)
+			}
+		})
+	}
+	events, _ := l.Events(context.Background(), Filter{})
+	if events[0].ID != 3 {
+		t.Errorf("events should be newest first, got ID %d first", events[0].ID)
+	}
+}
@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	databaseCfg "github.com/NhyiraAmofaSekyi/go-webserver/internal/db"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/db/database"
+)
+
+// PostgresStore keeps events in the audit_events table, which rejects
+// updates and deletes
+type PostgresStore struct {
+	db *databaseCfg.DBConfig
+}
+
+func NewPostgresStore(db *databaseCfg.DBConfig) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Append chains event to the latest one under an advisory lock held until
+// the insert commits, so instances writing at once cannot fork the chain
+func (s *PostgresStore) Append(ctx context.Context, event Event) (Event, error) {
+	err := s.db.WithTx(ctx, func(q *database.Queries) error {
+		if err := q.LockAuditChain(ctx); err != nil {
+			return err
+		}
+		prev, err := q.GetLatestAuditHash(ctx)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		event.Chain(prev)
+
+		details, err := json.Marshal(event.Details)
+		if err != nil {
+			return err
+		}
+		row, err := q.InsertAuditEvent(ctx, database.InsertAuditEventParams{
+			OccurredAt: event.OccurredAt,
+			Actor:      event.Actor,
+			Action:     event.Action,
+			Target:     event.Target,
+			Outcome:    event.Outcome,
+			Ip:         event.IP,
+			RequestID:  event.RequestID,
+			Details:    details,
+			PrevHash:   event.PrevHash,
+			Hash:       event.Hash,
+		})
+		if err != nil {
+			return err
+		}
+		event.ID = row.ID
+		return nil
+	})
+	return event, err
+}
+
+func (s *PostgresStore) List(ctx context.Context, filter Filter) ([]Event, error) {
+	rows, err := s.db.DB.ListAuditEvents(ctx, database.ListAuditEventsParams{
+		Actor:    sql.NullString{String: filter.Actor, Valid: filter.Actor != ""},
+		Action:   sql.NullString{String: filter.Action, Valid: filter.Action != ""},
+		Since:    sql.NullTime{Time: filter.Since.UTC(), Valid: !filter.Since.IsZero()},
+		Until:    sql.NullTime{Time: filter.Until.UTC(), Valid: !filter.Until.IsZero()},
+		BeforeID: sql.NullInt64{Int64: filter.BeforeID, Valid: filter.BeforeID > 0},
+		MaxRows:  int32(filter.Limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromRows(rows)
+}
+
+func (s *PostgresStore) ListAfter(ctx context.Context, afterID int64, limit int) ([]Event, error) {
+	rows, err := s.db.DB.ListAuditEventsAfter(ctx, database.ListAuditEventsAfterParams{
+		ID:    afterID,
+		Limit: int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromRows(rows)
+}
+
+func fromRows(rows []database.AuditEvent) ([]Event, error) {
+	events := make([]Event, 0, len(rows))
+	for _, row := range rows {
+		event := Event{
+			ID:         row.ID,
+			OccurredAt: row.OccurredAt.UTC(),
+			Actor:      row.Actor,
+			Action:     row.Action,
+			Target:     row.Target,
+			Outcome:    row.Outcome,
+			IP:         row.Ip,
+			RequestID:  row.RequestID,
+			PrevHash:   row.PrevHash,
+			Hash:       row.Hash,
+		}
+		if err := json.Unmarshal(row.Details, &event.Details); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
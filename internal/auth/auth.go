@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -11,17 +12,26 @@ var hmacSampleSecret = []byte("hqwebfoeuyrh38y24-821")
 
 // Function to generate a new JWT for a given name
 func GenerateJWT(name string) (string, error) {
+	return GenerateJWTWithRole(name, "")
+}
+
+// GenerateJWTWithRole generates a JWT carrying a role claim, e.g. "admin"
+func GenerateJWTWithRole(name string, role string) (string, error) {
 
 	if name == "" {
 		return "", fmt.Errorf("no string provided")
 	}
 	expirationTime := time.Now().Add(1 * time.Hour).Unix()
-	// Create a new token object, specifying signing method and the claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	claims := jwt.MapClaims{
 		"name": name, // Include the name in the token
 		"nbf":  time.Now().Unix(),
 		"exp":  expirationTime,
-	})
+	}
+	if role != "" {
+		claims["role"] = role
+	}
+	// Create a new token object, specifying signing method and the claims
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Sign and get the complete encoded token as a string using the secret
 	tokenString, err := token.SignedString(hmacSampleSecret)
@@ -46,7 +56,7 @@ func ParseJWT(tokenString string) (jwt.MapClaims, error) {
 
 	if err != nil {
 		// log.Fatalf("Error parsing token: %v", err)
-		return nil, fmt.Errorf("error parsing token: %v", err)
+		return nil, fmt.Errorf("error parsing token: %w", err)
 	}
 
 	// Type assertion to extract claims
@@ -57,3 +67,19 @@ func ParseJWT(tokenString string) (jwt.MapClaims, error) {
 		return nil, fmt.Errorf("invalid token or failed claims assertion")
 	}
 }
+
+// FailureReason classifies an error from ParseJWT for metrics: malformed,
+// invalid_signature, expired, not_yet_valid or invalid
+func FailureReason(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return "malformed"
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return "invalid_signature"
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "expired"
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return "not_yet_valid"
+	}
+	return "invalid"
+}
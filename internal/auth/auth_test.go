@@ -152,3 +152,64 @@ func TestParseJWT(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateJWTWithRole(t *testing.T) {
+	token, err := GenerateJWTWithRole("admin-user", "admin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	claims, err := ParseJWT(token)
+	if err != nil {
+		t.Fatalf("Failed to parse generated token: %v", err)
+	}
+	if role, ok := claims["role"].(string); !ok || role != "admin" {
+		t.Errorf("Expected role claim admin, got %v", claims["role"])
+	}
+
+	// Tokens without a role must not carry the claim at all
+	token, err = GenerateJWT("testuser")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	claims, err = ParseJWT(token)
+	if err != nil {
+		t.Fatalf("Failed to parse generated token: %v", err)
+	}
+	if _, ok := claims["role"]; ok {
+		t.Errorf("Expected no role claim, got %v", claims["role"])
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	sign := func(claims jwt.MapClaims, key []byte) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name        string
+		tokenString string
+		reason      string
+	}{
+		{name: "Malformed", tokenString: "invalid.token.string", reason: "malformed"},
+		{name: "Wrong Key", tokenString: sign(jwt.MapClaims{"name": "testuser"}, []byte("other")), reason: "invalid_signature"},
+		{name: "Expired", tokenString: sign(jwt.MapClaims{"name": "testuser", "exp": time.Now().Add(-time.Hour).Unix()}, hmacSampleSecret), reason: "expired"},
+		{name: "Not Yet Valid", tokenString: sign(jwt.MapClaims{"name": "testuser", "nbf": time.Now().Add(time.Hour).Unix()}, hmacSampleSecret), reason: "not_yet_valid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseJWT(tt.tokenString)
+			if err == nil {
+				t.Fatal("Expected error but got none")
+			}
+			if reason := FailureReason(err); reason != tt.reason {
+				t.Errorf("wrong reason: got %v want %v", reason, tt.reason)
+			}
+		})
+	}
+}
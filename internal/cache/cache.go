@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is a size bounded LRU cache whose entries expire after a TTL and can
+// be invalidated in groups by tag. It is safe for concurrent use.
+type Cache[V any] struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List // front is most recently used
+	items      map[string]*list.Element
+	tags       map[string]map[string]struct{}
+	now        func() time.Time
+	onEvict    func(key string, value V)
+}
+
+type entry[V any] struct {
+	key     string
+	value   V
+	expires time.Time // zero never expires
+	tags    []string
+}
+
+// New returns a cache holding at most maxEntries items, 0 means unbounded
+func New[V any](maxEntries int) *Cache[V] {
+	return &Cache[V]{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		tags:       make(map[string]map[string]struct{}),
+		now:        time.Now,
+	}
+}
+
+// OnEvict registers a callback run, with the lock held, when an entry is
+// dropped to make room for a new one. Expired and invalidated entries do not
+// trigger it.
+func (c *Cache[V]) OnEvict(fn func(key string, value V)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onEvict = fn
+}
+
+// Get returns the value for key if present and not expired
+func (c *Cache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	e := el.Value.(*entry[V])
+	if !e.expires.IsZero() && !c.now().Before(e.expires) {
+		c.removeElement(el)
+		return zero, false
+	}
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+// Set stores value under key for ttl, 0 never expires. The tags replace any
+// the key had before.
+func (c *Cache[V]) Set(key string, value V, ttl time.Duration, tags ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+
+	e := &entry[V]{key: key, value: value, expires: expires, tags: tags}
+	c.items[key] = c.ll.PushFront(e)
+	for _, tag := range tags {
+		keys, ok := c.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+
+	if c.maxEntries > 0 {
+		for c.ll.Len() > c.maxEntries {
+			oldest := c.ll.Back()
+			c.removeElement(oldest)
+			if c.onEvict != nil {
+				evicted := oldest.Value.(*entry[V])
+				c.onEvict(evicted.key, evicted.value)
+			}
+		}
+	}
+}
+
+// Delete removes key and reports whether it was present
+func (c *Cache[V]) Delete(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if ok {
+		c.removeElement(el)
+	}
+	return ok
+}
+
+// InvalidateTags removes every entry carrying one of the tags and returns
+// how many were removed
+func (c *Cache[V]) InvalidateTags(tags ...string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			if el, ok := c.items[key]; ok {
+				c.removeElement(el)
+				removed++
+			}
+		}
+	}
+	return removed
+}
+
+// Len returns the number of entries, including expired ones not yet removed
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Purge removes every entry
+func (c *Cache[V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.tags = make(map[string]map[string]struct{})
+}
+
+func (c *Cache[V]) removeElement(el *list.Element) {
+	e := el.Value.(*entry[V])
+	c.ll.Remove(el)
+	delete(c.items, e.key)
+	c.untag(e)
+}
+
+func (c *Cache[V]) untag(e *entry[V]) {
+	for _, tag := range e.tags {
+		if keys, ok := c.tags[tag]; ok {
+			delete(keys, e.key)
+			if len(keys) == 0 {
+				delete(c.tags, tag)
+			}
+		}
+	}
+}
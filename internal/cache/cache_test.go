@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEviction(t *testing.T) {
+	c := New[int](2)
+	var evicted []string
+	c.OnEvict(func(key string, value int) {
+		evicted = append(evicted, key)
+	})
+
+	c.Set("a", 1, 0)
+	c.Set("b", 2, 0)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	// b is now the least recently used entry
+	c.Set("c", 3, 0)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("wrong value for a: got %v, %v", v, ok)
+	}
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Errorf("wrong evictions: got %v want [b]", evicted)
+	}
+	if c.Len() != 2 {
+		t.Errorf("wrong length: got %d want 2", c.Len())
+	}
+}
+
+func TestTTL(t *testing.T) {
+	now := time.Now()
+	c := New[string](0)
+	c.now = func() time.Time { return now }
+
+	c.Set("short", "x", time.Second)
+	c.Set("forever", "y", 0)
+
+	now = now.Add(time.Second)
+	if _, ok := c.Get("short"); ok {
+		t.Error("expected short to have expired")
+	}
+	if _, ok := c.Get("forever"); !ok {
+		t.Error("expected forever to still be cached")
+	}
+	if c.Len() != 1 {
+		t.Errorf("expired entry not removed, length %d", c.Len())
+	}
+}
+
+func TestInvalidateTags(t *testing.T) {
+	c := New[int](0)
+	c.Set("objects:1", 1, 0, "objects")
+	c.Set("objects:2", 2, 0, "objects", "user:ama")
+	c.Set("users:1", 3, 0, "users")
+
+	if removed := c.InvalidateTags("objects"); removed != 2 {
+		t.Errorf("wrong number of entries invalidated: got %d want 2", removed)
+	}
+	if _, ok := c.Get("objects:2"); ok {
+		t.Error("expected objects:2 to be invalidated")
+	}
+	if _, ok := c.Get("users:1"); !ok {
+		t.Error("expected users:1 to survive")
+	}
+	if removed := c.InvalidateTags("user:ama"); removed != 0 {
+		t.Errorf("tag of removed entry still indexed, removed %d", removed)
+	}
+
+	// Overwriting an entry replaces its tags
+	c.Set("users:1", 4, 0, "other")
+	if removed := c.InvalidateTags("users"); removed != 0 {
+		t.Errorf("stale tag still indexed, removed %d", removed)
+	}
+
+	c.Purge()
+	if c.Len() != 0 {
+		t.Errorf("Purge left %d entries", c.Len())
+	}
+}
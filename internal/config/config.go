@@ -5,13 +5,22 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"sync"
 
 	"github.com/joho/godotenv"
 	"gopkg.in/yaml.v3"
 
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/audit"
 	databaseCfg "github.com/NhyiraAmofaSekyi/go-webserver/internal/db"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/debugserver"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/errreport"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/features"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/health"
 	"github.com/NhyiraAmofaSekyi/go-webserver/internal/logger"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/middleware"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/tracing"
 )
 
 // "golang.org/x/oauth2"
@@ -28,24 +37,68 @@ type ServerConfig struct {
 	ClientURL string `yaml:"client_url"`
 	Debug     bool   `yaml:"debug"`
 }
+
+// IPFilters restricts internal endpoints to the given networks
+type IPFilters struct {
+	Metrics middleware.IPFilterConfig `yaml:"metrics"`
+	Admin   middleware.IPFilterConfig `yaml:"admin"`
+}
+type EnvironmentConfig struct {
+	Server          ServerConfig                     `yaml:"server"`
+	Log             logger.FileConfig                `yaml:"log"`
+	SecurityHeaders middleware.SecurityHeadersConfig `yaml:"security_headers"`
+	Cors            middleware.CorsPolicies          `yaml:"cors"`
+	Idempotency     middleware.IdempotencyConfig     `yaml:"idempotency"`
+	AccessLog       middleware.AccessLogConfig       `yaml:"access_log"`
+	Maintenance     middleware.MaintenanceConfig     `yaml:"maintenance"`
+	RealIP          middleware.RealIPConfig          `yaml:"real_ip"`
+	IPFilters       IPFilters                        `yaml:"ip_filters"`
+	ResponseCache   middleware.ResponseCacheConfig   `yaml:"response_cache"`
+	LoadShedding    middleware.LoadSheddingConfig    `yaml:"load_shedding"`
+	BodyCapture     middleware.BodyCaptureConfig     `yaml:"body_capture"`
+	Features        []features.Flag                  `yaml:"features"`
+	Tracing         tracing.Config                   `yaml:"tracing"`
+	Health          health.Config                    `yaml:"health"`
+	DebugServer     debugserver.Config               `yaml:"debug_server"`
+	Audit           audit.Config                     `yaml:"audit"`
+	ErrorReporting  errreport.Config                 `yaml:"error_reporting"`
+	Metrics         monitoring.Config                `yaml:"metrics"`
+}
 type YAMLConfig struct {
 	Environments struct {
-		Local struct {
-			Server ServerConfig `yaml:"server"`
-		} `yaml:"local"`
-		Production struct {
-			Server ServerConfig `yaml:"server"`
-		} `yaml:"production"`
+		Local      EnvironmentConfig `yaml:"local"`
+		Production EnvironmentConfig `yaml:"production"`
 	} `yaml:"environments"`
 }
 
 type Con struct {
-	DBConfig  *databaseCfg.DBConfig
-	ClientURL string `yaml:"client_url"`
-	APIHost   string `yaml:"api_host"`
-	APIPort   int    `yaml:"api_port"`
+	DBConfig        *databaseCfg.DBConfig
+	ClientURL       string `yaml:"client_url"`
+	APIHost         string `yaml:"api_host"`
+	APIPort         int    `yaml:"api_port"`
+	SecurityHeaders middleware.SecurityHeadersConfig
+	Cors            middleware.CorsPolicies
+	Idempotency     middleware.IdempotencyConfig
+	AccessLog       middleware.AccessLogConfig
+	Maintenance     middleware.MaintenanceConfig
+	RealIP          middleware.RealIPConfig
+	IPFilters       IPFilters
+	ResponseCache   middleware.ResponseCacheConfig
+	LoadShedding    middleware.LoadSheddingConfig
+	BodyCapture     middleware.BodyCaptureConfig
+	Features        []features.Flag
+	Tracing         tracing.Config
+	Health          health.Config
+	DebugServer     debugserver.Config
+	Audit           audit.Config
+	ErrorReporting  errreport.Config
+	Metrics         monitoring.Config
+	AdminUsers      map[string]string // name to sign-in secret, from ADMIN_USERS
 }
 
+// minAdminSecretLength keeps admin secrets out of reach of guessing
+const minAdminSecretLength = 16
+
 func Initialise() {
 	once.Do(func() {
 		envPtr := flag.String("env", "development", "Define the application environment (development or production)")
@@ -66,15 +119,16 @@ func Initialise() {
 		if err := yaml.Unmarshal(data, &yamlConfig); err != nil {
 			log.Fatal("Error parsing config:", err)
 		}
-		var serverConfig ServerConfig
+		var envConfig EnvironmentConfig
 		if env == "production" {
-			serverConfig = yamlConfig.Environments.Production.Server
+			envConfig = yamlConfig.Environments.Production
 		} else {
-			serverConfig = yamlConfig.Environments.Local.Server
+			envConfig = yamlConfig.Environments.Local
 		}
+		serverConfig := envConfig.Server
 
 		// Initialize logger with debug mode from config
-		logger.Init(serverConfig.Debug)
+		logger.InitWithConfig(serverConfig.Debug, &envConfig.Log)
 		logger.Debug("Initializing configuration for environment: %s", env)
 
 		dbURL := os.Getenv("DB_URL")
@@ -93,10 +147,27 @@ func Initialise() {
 		logger.Info("Database connection established successfully")
 
 		Config = &Con{
-			DBConfig:  dbConfig,
-			ClientURL: serverConfig.ClientURL,
-			APIHost:   serverConfig.Host,
-			APIPort:   serverConfig.Port,
+			DBConfig:        dbConfig,
+			ClientURL:       serverConfig.ClientURL,
+			APIHost:         serverConfig.Host,
+			APIPort:         serverConfig.Port,
+			SecurityHeaders: envConfig.SecurityHeaders,
+			Cors:            envConfig.Cors,
+			Idempotency:     envConfig.Idempotency,
+			AccessLog:       envConfig.AccessLog,
+			Maintenance:     envConfig.Maintenance,
+			RealIP:          envConfig.RealIP,
+			IPFilters:       envConfig.IPFilters,
+			ResponseCache:   envConfig.ResponseCache,
+			LoadShedding:    envConfig.LoadShedding,
+			BodyCapture:     envConfig.BodyCapture,
+			Features:        envConfig.Features,
+			Tracing:         envConfig.Tracing,
+			Health:          envConfig.Health,
+			DebugServer:     envConfig.DebugServer,
+			Audit:           envConfig.Audit,
+			ErrorReporting:  envConfig.ErrorReporting,
+			Metrics:         envConfig.Metrics,
 		}
 		logger.Debug("Base configuration created: %+v", Config)
 
@@ -109,6 +180,23 @@ func Initialise() {
 			Config.APIHost = host
 			logger.Debug("Overrode APIHost from environment: %s", host)
 		}
+		Config.DebugServer.Password = os.Getenv("DEBUG_PASSWORD")
+		Config.Metrics.Password = os.Getenv("METRICS_PASSWORD")
+		Config.Metrics.Token = os.Getenv("METRICS_TOKEN")
+		if dsn := os.Getenv("SENTRY_DSN"); dsn != "" {
+			Config.ErrorReporting.Sentry.DSN = dsn
+		}
+		Config.AdminUsers = map[string]string{}
+		for _, entry := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+			if entry = strings.TrimSpace(entry); entry == "" {
+				continue
+			}
+			name, secret, _ := strings.Cut(entry, ":")
+			if name == "" || len(secret) < minAdminSecretLength {
+				logger.Fatal("ADMIN_USERS entry for %q needs a secret of at least %d characters, as name:secret", name, minAdminSecretLength)
+			}
+			Config.AdminUsers[name] = secret
+		}
 	})
 
 }
@@ -5,11 +5,47 @@
 package database
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type AuditEvent struct {
+	ID         int64
+	OccurredAt time.Time
+	Actor      string
+	Action     string
+	Target     string
+	Outcome    string
+	Ip         string
+	RequestID  string
+	Details    json.RawMessage
+	PrevHash   string
+	Hash       string
+}
+
+type FeatureFlag struct {
+	Name        string
+	Description string
+	Enabled     bool
+	Rollout     int32
+	Users       []string
+	Roles       []string
+	UpdatedAt   time.Time
+}
+
+type IdempotencyKey struct {
+	Key             string
+	Fingerprint     string
+	StatusCode      sql.NullInt32
+	ResponseHeaders []byte
+	ResponseBody    []byte
+	CreatedAt       time.Time
+	ExpiresAt       time.Time
+}
+
 type User struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
@@ -1,10 +1,12 @@
 package databaseCfg
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
 	"github.com/NhyiraAmofaSekyi/go-webserver/internal/db/database"
+	monitoring "github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
 	_ "github.com/lib/pq"
 )
 
@@ -29,7 +31,11 @@ func NewDBConfig(dbURL string) (*DBConfig, error) {
 		return nil, fmt.Errorf("can't ping database: %v", err)
 	}
 
-	db := database.New(conn)
+	if err := monitoring.RegisterDBStats(conn, "postgres"); err != nil {
+		return nil, fmt.Errorf("can't register database metrics: %v", err)
+	}
+
+	db := database.New(NewInstrumentedDB(NewTracedDB(conn)))
 
 	dbConfig := &DBConfig{
 		DB:   db,
@@ -38,3 +44,18 @@ func NewDBConfig(dbURL string) (*DBConfig, error) {
 
 	return dbConfig, nil
 }
+
+// WithTx runs fn in a transaction with queries that are traced and timed
+// like DB's. The transaction is committed if fn returns nil and rolled back
+// otherwise.
+func (c *DBConfig) WithTx(ctx context.Context, fn func(*database.Queries) error) error {
+	tx, err := c.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	if err := fn(database.New(NewInstrumentedDB(NewTracedDB(tx)))); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
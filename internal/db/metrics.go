@@ -0,0 +1,59 @@
+package databaseCfg
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/db/database"
+	monitoring "github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
+)
+
+// InstrumentedDB wraps a database.DBTX to record the latency and errors of
+// every sqlc query, labelled by query name
+type InstrumentedDB struct {
+	db database.DBTX
+}
+
+func NewInstrumentedDB(db database.DBTX) *InstrumentedDB {
+	return &InstrumentedDB{db: db}
+}
+
+func observe(query string, start time.Time, err error) {
+	name := queryName(query)
+	monitoring.DbQueryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	// No rows is an answer, not a failure
+	if err != nil && err != sql.ErrNoRows {
+		monitoring.DbQueryErrorsTotal.WithLabelValues(name).Inc()
+	}
+}
+
+func (i *InstrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := i.db.ExecContext(ctx, query, args...)
+	observe(query, start, err)
+	return result, err
+}
+
+func (i *InstrumentedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	start := time.Now()
+	stmt, err := i.db.PrepareContext(ctx, query)
+	observe(query, start, err)
+	return stmt, err
+}
+
+// QueryContext records the time until the first rows are available, reading
+// them is not included
+func (i *InstrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := i.db.QueryContext(ctx, query, args...)
+	observe(query, start, err)
+	return rows, err
+}
+
+func (i *InstrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := i.db.QueryRowContext(ctx, query, args...)
+	observe(query, start, row.Err())
+	return row
+}
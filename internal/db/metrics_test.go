@@ -0,0 +1,113 @@
+package databaseCfg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/db/database"
+	monitoring "github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
+)
+
+// fakeDB fails every Exec with err
+type fakeDB struct {
+	database.DBTX
+	err error
+}
+
+func (f *fakeDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, f.err
+}
+
+// sample returns the observation count of the query's latency histogram and
+// its error count
+func sample(t *testing.T, query string) (uint64, float64) {
+	families, err := monitoring.Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	var count uint64
+	var errs float64
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			if len(metric.GetLabel()) != 1 || metric.GetLabel()[0].GetValue() != query {
+				continue
+			}
+			switch family.GetName() {
+			case "db_query_duration_seconds":
+				count = metric.GetHistogram().GetSampleCount()
+			case "db_query_errors_total":
+				errs = metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return count, errs
+}
+
+func TestInstrumentedDB(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		err            error
+		expectedErrors float64
+	}{
+		{name: "Success", query: "-- name: TestSuccess :exec\nSELECT 1", expectedErrors: 0},
+		{name: "Failure", query: "-- name: TestFailure :exec\nSELECT 1", err: errors.New("connection reset"), expectedErrors: 1},
+		{name: "No Rows Is Not An Error", query: "-- name: TestNoRows :exec\nSELECT 1", err: sql.ErrNoRows, expectedErrors: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := NewInstrumentedDB(&fakeDB{err: tt.err})
+			db.ExecContext(context.Background(), tt.query)
+
+			name := queryName(tt.query)
+			count, errs := sample(t, name)
+			if count != 1 {
+				t.Errorf("wrong latency observations for %s: got %v want 1", name, count)
+			}
+			if errs != tt.expectedErrors {
+				t.Errorf("wrong error count for %s: got %v want %v", name, errs, tt.expectedErrors)
+			}
+		})
+	}
+}
+
+func TestRegisterDBStats(t *testing.T) {
+	// lib/pq does not connect until the first query
+	conn, err := sql.Open("postgres", "postgres://localhost/test?sslmode=disable")
+	if err != nil {
+		t.Fatalf("sql.Open returned error: %v", err)
+	}
+	defer conn.Close()
+
+	if err := monitoring.RegisterDBStats(conn, "stats-test"); err != nil {
+		t.Fatalf("RegisterDBStats returned error: %v", err)
+	}
+	families, err := monitoring.Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	found := make(map[string]bool)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "db_name" && label.GetValue() == "stats-test" {
+					found[family.GetName()] = true
+				}
+			}
+		}
+	}
+	for _, name := range []string{
+		"go_sql_open_connections",
+		"go_sql_in_use_connections",
+		"go_sql_idle_connections",
+		"go_sql_wait_count_total",
+		"go_sql_wait_duration_seconds_total",
+	} {
+		if !found[name] {
+			t.Errorf("%s is not exported", name)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+-- name: LockAuditChain :exec
+SELECT pg_advisory_xact_lock(hashtext('audit_events'));
+
+-- name: GetLatestAuditHash :one
+SELECT hash FROM audit_events
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: InsertAuditEvent :one
+INSERT INTO audit_events (occurred_at, actor, action, target, outcome, ip, request_id, details, prev_hash, hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING *;
+
+-- name: ListAuditEvents :many
+SELECT * FROM audit_events
+WHERE (sqlc.narg('actor')::text IS NULL OR actor = sqlc.narg('actor'))
+  AND (sqlc.narg('action')::text IS NULL OR action = sqlc.narg('action'))
+  AND (sqlc.narg('since')::timestamp IS NULL OR occurred_at >= sqlc.narg('since'))
+  AND (sqlc.narg('until')::timestamp IS NULL OR occurred_at < sqlc.narg('until'))
+  AND (sqlc.narg('before_id')::bigint IS NULL OR id < sqlc.narg('before_id'))
+ORDER BY id DESC
+LIMIT sqlc.arg('max_rows');
+
+-- name: ListAuditEventsAfter :many
+SELECT * FROM audit_events
+WHERE id > $1
+ORDER BY id
+LIMIT $2;
@@ -0,0 +1,15 @@
+-- name: ListFeatureFlags :many
+SELECT * FROM feature_flags
+ORDER BY name;
+
+-- name: UpsertFeatureFlag :one
+INSERT INTO feature_flags (name, description, enabled, rollout, users, roles, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)
+ON CONFLICT (name) DO UPDATE
+SET description = EXCLUDED.description,
+    enabled = EXCLUDED.enabled,
+    rollout = EXCLUDED.rollout,
+    users = EXCLUDED.users,
+    roles = EXCLUDED.roles,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
@@ -0,0 +1,11 @@
+CREATE TABLE idempotency_keys (
+   key TEXT PRIMARY KEY,
+   fingerprint TEXT NOT NULL,
+   status_code INTEGER,
+   response_headers BYTEA,
+   response_body BYTEA,
+   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
@@ -0,0 +1,9 @@
+CREATE TABLE feature_flags (
+   name TEXT PRIMARY KEY,
+   description TEXT NOT NULL DEFAULT '',
+   enabled BOOLEAN NOT NULL DEFAULT FALSE,
+   rollout INTEGER NOT NULL DEFAULT 0 CHECK (rollout BETWEEN 0 AND 100),
+   users TEXT[] NOT NULL DEFAULT '{}',
+   roles TEXT[] NOT NULL DEFAULT '{}',
+   updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,32 @@
+CREATE TABLE audit_events (
+   id BIGSERIAL PRIMARY KEY,
+   occurred_at TIMESTAMP NOT NULL,
+   actor TEXT NOT NULL,
+   action TEXT NOT NULL,
+   target TEXT NOT NULL DEFAULT '',
+   outcome TEXT NOT NULL,
+   ip TEXT NOT NULL DEFAULT '',
+   request_id TEXT NOT NULL DEFAULT '',
+   details JSON NOT NULL DEFAULT '{}',
+   prev_hash TEXT NOT NULL,
+   hash TEXT NOT NULL UNIQUE
+);
+
+CREATE INDEX audit_events_actor_idx ON audit_events (actor, id);
+CREATE INDEX audit_events_action_idx ON audit_events (action, id);
+CREATE INDEX audit_events_occurred_at_idx ON audit_events (occurred_at);
+
+-- Rows can only be appended, any update, delete or truncate is rejected
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+   RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_update_delete
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+BEFORE TRUNCATE ON audit_events
+FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
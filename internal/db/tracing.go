@@ -0,0 +1,89 @@
+package databaseCfg
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/db/database"
+)
+
+const tracerName = "github.com/NhyiraAmofaSekyi/go-webserver/internal/db"
+
+// TracedDB wraps a database.DBTX so every sqlc query runs in a client span
+// named after the query, e.g. "GetUsers"
+type TracedDB struct {
+	db database.DBTX
+}
+
+func NewTracedDB(db database.DBTX) *TracedDB {
+	return &TracedDB{db: db}
+}
+
+// queryName reads the name sqlc puts on the first line of each query,
+// "-- name: GetUsers :many"
+func queryName(query string) string {
+	line, _, _ := strings.Cut(query, "\n")
+	if rest, ok := strings.CutPrefix(line, "-- name: "); ok {
+		if name, _, ok := strings.Cut(rest, " "); ok {
+			return name
+		}
+		return rest
+	}
+	return "query"
+}
+
+func (t *TracedDB) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := queryName(query)
+	return otel.Tracer(tracerName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(name),
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+func end(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t *TracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	result, err := t.db.ExecContext(ctx, query, args...)
+	end(span, err)
+	return result, err
+}
+
+func (t *TracedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := t.start(ctx, query)
+	stmt, err := t.db.PrepareContext(ctx, query)
+	end(span, err)
+	return stmt, err
+}
+
+// QueryContext ends the span once the query has run, reading the rows is
+// not included
+func (t *TracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	end(span, err)
+	return rows, err
+}
+
+func (t *TracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	row := t.db.QueryRowContext(ctx, query, args...)
+	end(span, row.Err())
+	return row
+}
@@ -0,0 +1,184 @@
+package debugserver
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"time"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/middleware"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
+	"github.com/NhyiraAmofaSekyi/go-webserver/utils"
+)
+
+// Config of the admin debug listener. It is only started when enabled and
+// requires basic auth, an IP allow list, or both.
+type Config struct {
+	Enabled  bool                      `yaml:"enabled"`
+	Addr     string                    `yaml:"addr"` // e.g. "127.0.0.1:6060"
+	Username string                    `yaml:"username"`
+	Password string                    `yaml:"-"` // from DEBUG_PASSWORD
+	IPFilter middleware.IPFilterConfig `yaml:"ip_filter"`
+}
+
+// Handler returns the debug endpoints behind the configured protection:
+//
+//	/metrics             Prometheus metrics
+//	/debug/pprof/        net/http/pprof profiles
+//	/debug/vars          expvar
+//	/debug/goroutines    stack dump of every goroutine
+//	/debug/gc            GC and memory stats
+//	/debug/build         build and dependency info
+func Handler(config *Config) (http.Handler, error) {
+	if config.Username == "" && len(config.IPFilter.Allow) == 0 {
+		return nil, fmt.Errorf("debug listener needs a username or an IP allow list")
+	}
+	if config.Username != "" && config.Password == "" {
+		return nil, fmt.Errorf("debug listener username is set but DEBUG_PASSWORD is empty")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", monitoring.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	mux.HandleFunc("GET /debug/goroutines", goroutines)
+	mux.HandleFunc("GET /debug/gc", gcStats)
+	mux.HandleFunc("GET /debug/build", buildInfo)
+
+	protections := []middleware.Middleware{}
+	if len(config.IPFilter.Allow) > 0 || len(config.IPFilter.Deny) > 0 {
+		filter, err := middleware.NewIPFilter(&config.IPFilter)
+		if err != nil {
+			return nil, fmt.Errorf("debug listener IP filter: %w", err)
+		}
+		protections = append(protections, filter)
+	}
+	if config.Username != "" {
+		protections = append(protections, middleware.BasicAuth("debug", config.Username, config.Password))
+	}
+	return middleware.CreateStack(protections...)(mux), nil
+}
+
+// NewServer returns the debug listener's server, start it with ListenAndServe
+func NewServer(config *Config) (*http.Server, error) {
+	handler, err := Handler(config)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Server{
+		Addr:              config.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		// No WriteTimeout, CPU profiles and traces stream for as long as requested
+		IdleTimeout: 120 * time.Second,
+	}, nil
+}
+
+func goroutines(w http.ResponseWriter, r *http.Request) {
+	// debug=2 prints every goroutine with its full stack, like an unrecovered panic
+	pprof.Handler("goroutine").ServeHTTP(w, withQuery(r, "debug", "2"))
+}
+
+func withQuery(r *http.Request, key, value string) *http.Request {
+	r2 := r.Clone(r.Context())
+	query := r2.URL.Query()
+	query.Set(key, value)
+	r2.URL.RawQuery = query.Encode()
+	return r2
+}
+
+type gcReport struct {
+	NumGC          int64     `json:"num_gc"`
+	LastGC         time.Time `json:"last_gc"`
+	PauseTotalMs   float64   `json:"pause_total_ms"`
+	RecentPausesMs []float64 `json:"recent_pauses_ms"` // newest first
+	HeapAllocBytes uint64    `json:"heap_alloc_bytes"`
+	HeapSysBytes   uint64    `json:"heap_sys_bytes"`
+	HeapObjects    uint64    `json:"heap_objects"`
+	NextGCBytes    uint64    `json:"next_gc_bytes"`
+	TotalAlloc     uint64    `json:"total_alloc_bytes"`
+	SysBytes       uint64    `json:"sys_bytes"`
+	Goroutines     int       `json:"goroutines"`
+	GOMAXPROCS     int       `json:"gomaxprocs"`
+	GCPercent      int       `json:"gc_percent"`
+	MemoryLimit    int64     `json:"memory_limit_bytes"`
+}
+
+func gcStats(w http.ResponseWriter, r *http.Request) {
+	var stats debug.GCStats
+	debug.ReadGCStats(&stats)
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	report := gcReport{
+		NumGC:          stats.NumGC,
+		LastGC:         stats.LastGC,
+		PauseTotalMs:   float64(stats.PauseTotal.Microseconds()) / 1000,
+		RecentPausesMs: []float64{},
+		HeapAllocBytes: mem.HeapAlloc,
+		HeapSysBytes:   mem.HeapSys,
+		HeapObjects:    mem.HeapObjects,
+		NextGCBytes:    mem.NextGC,
+		TotalAlloc:     mem.TotalAlloc,
+		SysBytes:       mem.Sys,
+		Goroutines:     runtime.NumGoroutine(),
+		GOMAXPROCS:     runtime.GOMAXPROCS(0),
+		MemoryLimit:    debug.SetMemoryLimit(-1), // a negative limit only reads it
+	}
+	// debug.SetGCPercent can't read without setting, runtime/metrics can
+	sample := []metrics.Sample{{Name: "/gc/gogc:percent"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() == metrics.KindUint64 {
+		report.GCPercent = int(sample[0].Value.Uint64())
+	}
+	for i, pause := range stats.Pause {
+		if i == 10 {
+			break
+		}
+		report.RecentPausesMs = append(report.RecentPausesMs, float64(pause.Microseconds())/1000)
+	}
+	utils.RespondWithJSON(w, http.StatusOK, report)
+}
+
+type module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+type buildReport struct {
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path"`
+	Main      module            `json:"main"`
+	Settings  map[string]string `json:"settings"` // vcs.revision, vcs.time, GOOS, ...
+	Deps      []module          `json:"deps"`
+}
+
+func buildInfo(w http.ResponseWriter, r *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "build info is not available")
+		return
+	}
+	report := buildReport{
+		GoVersion: info.GoVersion,
+		Path:      info.Path,
+		Main:      module{Path: info.Main.Path, Version: info.Main.Version},
+		Settings:  make(map[string]string, len(info.Settings)),
+		Deps:      make([]module, 0, len(info.Deps)),
+	}
+	for _, setting := range info.Settings {
+		report.Settings[setting.Key] = setting.Value
+	}
+	for _, dep := range info.Deps {
+		report.Deps = append(report.Deps, module{Path: dep.Path, Version: dep.Version})
+	}
+	utils.RespondWithJSON(w, http.StatusOK, report)
+}
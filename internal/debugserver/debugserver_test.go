@@ -0,0 +1,96 @@
+package debugserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/middleware"
+)
+
+func TestHandler(t *testing.T) {
+	handler, err := Handler(&Config{
+		Username: "ops",
+		Password: "s3cret",
+		IPFilter: middleware.IPFilterConfig{Allow: []string{"10.0.0.0/8"}},
+	})
+	if err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		remoteAddr     string
+		authenticate   bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Metrics", path: "/metrics", remoteAddr: "10.0.0.5:4000", authenticate: true, expectedStatus: http.StatusOK, expectedBody: "go_goroutines"},
+		{name: "Pprof Index", path: "/debug/pprof/", remoteAddr: "10.0.0.5:4000", authenticate: true, expectedStatus: http.StatusOK, expectedBody: "goroutine"},
+		{name: "Expvar", path: "/debug/vars", remoteAddr: "10.0.0.5:4000", authenticate: true, expectedStatus: http.StatusOK, expectedBody: "memstats"},
+		{name: "Goroutine Dump", path: "/debug/goroutines", remoteAddr: "10.0.0.5:4000", authenticate: true, expectedStatus: http.StatusOK, expectedBody: "goroutine "},
+		{name: "GC Stats", path: "/debug/gc", remoteAddr: "10.0.0.5:4000", authenticate: true, expectedStatus: http.StatusOK, expectedBody: `"num_gc"`},
+		{name: "Outside Allow List", path: "/debug/vars", remoteAddr: "203.0.113.7:4000", authenticate: true, expectedStatus: http.StatusForbidden},
+		{name: "Missing Credentials", path: "/debug/vars", remoteAddr: "10.0.0.5:4000", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.authenticate {
+				req.SetBasicAuth("ops", "s3cret")
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("body does not contain %q: %.200s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	handler, err := Handler(&Config{IPFilter: middleware.IPFilterConfig{Allow: []string{"0.0.0.0/0"}}})
+	if err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/build", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var report buildReport
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatalf("Could not decode build info: %v", err)
+	}
+	if !strings.HasPrefix(report.GoVersion, "go") {
+		t.Errorf("wrong go version: %q", report.GoVersion)
+	}
+}
+
+func TestUnprotectedConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{name: "No Protection", config: Config{Addr: ":6060"}},
+		{name: "Username Without Password", config: Config{Username: "ops"}},
+		{name: "Deny List Only", config: Config{IPFilter: middleware.IPFilterConfig{Deny: []string{"10.0.0.0/8"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Handler(&tt.config); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
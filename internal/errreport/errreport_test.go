@@ -0,0 +1,299 @@
+package errreport
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySink keeps the reports it is sent
+type memorySink struct {
+	mu      sync.Mutex
+	reports []*Report
+}
+
+func (s *memorySink) Name() string { return "memory" }
+
+func (s *memorySink) Send(ctx context.Context, report *Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reports = append(s.reports, report)
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+// newTestReporter returns a reporter sending to a memorySink on a clock the
+// test moves with advance
+func newTestReporter(t *testing.T, config Config) (*Reporter, *memorySink, func(time.Duration)) {
+	t.Helper()
+	config.Enabled = true
+	config.File.Path = filepath.Join(t.TempDir(), "errors.jsonl")
+	r, err := New(&config)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	sink := &memorySink{}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	r.sinks = []Sink{sink}
+	r.now = func() time.Time { return now }
+	return r, sink, func(d time.Duration) { now = now.Add(d) }
+}
+
+func closeReporter(t *testing.T, r *Reporter) {
+	t.Helper()
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	report := func(kind, culprit, message string) *Report {
+		return &Report{Kind: kind, Culprit: culprit, Message: message}
+	}
+	tests := []struct {
+		name string
+		a, b *Report
+		same bool
+	}{
+		{
+			name: "Other Number",
+			a:    report(KindLog, "main.handler", "user 42 not found"),
+			b:    report(KindLog, "main.handler", "user 43 not found"),
+			same: true,
+		},
+		{
+			name: "Other UUID",
+			a:    report(KindLog, "main.handler", "file 0b6f2c1e-6d8e-4c43-9a55-3f7a1f0e2d11 missing"),
+			b:    report(KindLog, "main.handler", "file 9c1d7e20-1a2b-4c3d-8e9f-0a1b2c3d4e5f missing"),
+			same: true,
+		},
+		{
+			name: "Other Message",
+			a:    report(KindLog, "main.handler", "user 42 not found"),
+			b:    report(KindLog, "main.handler", "user 42 is locked"),
+		},
+		{
+			name: "Other Culprit",
+			a:    report(KindLog, "main.handler", "user 42 not found"),
+			b:    report(KindLog, "main.other", "user 42 not found"),
+		},
+		{
+			name: "Other Kind",
+			a:    report(KindLog, "main.handler", "user 42 not found"),
+			b:    report(KindPanic, "main.handler", "user 42 not found"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := fingerprint(tt.a) == fingerprint(tt.b); same != tt.same {
+				t.Errorf("same fingerprint: got %v want %v", same, tt.same)
+			}
+		})
+	}
+}
+
+func TestReportGroupsByFingerprint(t *testing.T) {
+	r, sink, advance := newTestReporter(t, Config{GroupWindow: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		r.Report(&Report{Kind: KindLog, Culprit: "main.handler", Message: "query failed"})
+	}
+	r.Report(&Report{Kind: KindLog, Culprit: "main.handler", Message: "timeout"})
+	advance(time.Minute)
+	r.Report(&Report{Kind: KindLog, Culprit: "main.handler", Message: "query failed"})
+	closeReporter(t, r)
+
+	counts := []int{}
+	for _, report := range sink.reports {
+		counts = append(counts, report.Count)
+	}
+	// The two suppressed within the window are counted in the next report
+	if len(counts) != 3 || counts[0] != 1 || counts[1] != 1 || counts[2] != 3 {
+		t.Errorf("wrong counts sent: got %v want [1 1 3]", counts)
+	}
+	if sink.reports[0].ID == "" || sink.reports[0].Fingerprint == "" {
+		t.Errorf("report was not given an ID and fingerprint: %+v", sink.reports[0])
+	}
+}
+
+func TestReportRateLimit(t *testing.T) {
+	r, sink, advance := newTestReporter(t, Config{RateLimit: 60, Burst: 2})
+
+	messages := []string{"a failed", "b failed", "c failed", "d failed"}
+	for _, message := range messages {
+		r.Report(&Report{Kind: KindLog, Message: message})
+	}
+	// One token per second comes back
+	advance(time.Second)
+	r.Report(&Report{Kind: KindLog, Message: "c failed"})
+	closeReporter(t, r)
+
+	got := []string{}
+	for _, report := range sink.reports {
+		got = append(got, report.Message)
+	}
+	if strings.Join(got, ",") != "a failed,b failed,c failed" {
+		t.Errorf("wrong reports sent: got %v", got)
+	}
+	if sink.reports[2].Count != 2 {
+		t.Errorf("rate limited report should be counted: got count %d want 2", sink.reports[2].Count)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reports", "errors.jsonl")
+	r, err := New(&Config{Enabled: true, File: FileSinkConfig{Path: path}})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	r.Report(&Report{Kind: KindLog, Message: "first", Stack: Stack(0)})
+	r.Report(&Report{Kind: KindLog, Message: "second"})
+	closeReporter(t, r)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open report file: %v", err)
+	}
+	defer f.Close()
+	var reports []Report
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var report Report
+		if err := json.Unmarshal(scanner.Bytes(), &report); err != nil {
+			t.Fatalf("line is not a JSON report: %v", err)
+		}
+		reports = append(reports, report)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("expected 2 reports, got %d", len(reports))
+	}
+	if reports[0].Culprit != "github.com/NhyiraAmofaSekyi/go-webserver/internal/errreport.TestFileSink" {
+		t.Errorf("wrong culprit: got %q", reports[0].Culprit)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	var body Report
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		received <- r
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink(&WebhookSinkConfig{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer secret"}})
+	if err != nil {
+		t.Fatalf("NewWebhookSink returned error: %v", err)
+	}
+	if err := sink.Send(context.Background(), &Report{ID: "1", Kind: KindPanic, Message: "boom"}); err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	req := <-received
+	if req.Header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("configured header not sent: got %q", req.Header.Get("Authorization"))
+	}
+	if body.Message != "boom" {
+		t.Errorf("wrong report received: %+v", body)
+	}
+}
+
+func TestSentrySink(t *testing.T) {
+	var (
+		path  string
+		auth  string
+		event map[string]any
+	)
+	status := http.StatusOK
+	// Stands in for the store endpoint of a Sentry server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		auth = r.Header.Get("X-Sentry-Auth")
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &event)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	dsn := strings.Replace(server.URL, "://", "://publickey@", 1) + "/42"
+	sink, err := NewSentrySink(&SentrySinkConfig{DSN: dsn})
+	if err != nil {
+		t.Fatalf("NewSentrySink returned error: %v", err)
+	}
+	report := &Report{
+		ID:          "0b6f2c1e-6d8e-4c43-9a55-3f7a1f0e2d11",
+		Kind:        KindPanic,
+		Message:     "boom",
+		Fingerprint: "abc",
+		Timestamp:   time.Now(),
+		Count:       3,
+		Stack:       []Frame{{Function: "main.inner", File: "main.go", Line: 2}, {Function: "main.outer", File: "main.go", Line: 1}},
+		User:        &User{ID: "ama"},
+	}
+	if err := sink.Send(context.Background(), report); err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+
+	if path != "/api/42/store/" {
+		t.Errorf("wrong endpoint: got %q", path)
+	}
+	if !strings.Contains(auth, "sentry_key=publickey") {
+		t.Errorf("missing key in auth header: %q", auth)
+	}
+	if event["event_id"] != "0b6f2c1e6d8e4c439a553f7a1f0e2d11" || event["level"] != "fatal" {
+		t.Errorf("wrong event: id %v level %v", event["event_id"], event["level"])
+	}
+	frames := event["exception"].(map[string]any)["values"].([]any)[0].(map[string]any)["stacktrace"].(map[string]any)["frames"].([]any)
+	if frames[0].(map[string]any)["function"] != "main.outer" {
+		t.Errorf("frames should be oldest first, got %v first", frames[0])
+	}
+
+	status = http.StatusTooManyRequests
+	if err := sink.Send(context.Background(), report); err == nil {
+		t.Error("expected an error for a non-2xx response")
+	}
+
+	if _, err := NewSentrySink(&SentrySinkConfig{DSN: "https://sentry.example.com/42"}); err == nil {
+		t.Error("expected an error for a DSN without a key")
+	}
+}
+
+func TestLogHook(t *testing.T) {
+	r, sink, _ := newTestReporter(t, Config{})
+
+	var pcs [1]uintptr
+	runtime.Callers(1, pcs[:])
+	record := slog.NewRecord(time.Now(), slog.LevelError, "query failed", pcs[0])
+	record.Add("request_id", "req-1", "user_id", "ama", "table", "users")
+	r.LogHook(context.Background(), record)
+	r.LogHook(Skip(context.Background()), record)
+	closeReporter(t, r)
+
+	if len(sink.reports) != 1 {
+		t.Fatalf("expected 1 report, skipped context included, got %d", len(sink.reports))
+	}
+	report := sink.reports[0]
+	if report.Culprit != "github.com/NhyiraAmofaSekyi/go-webserver/internal/errreport.TestLogHook" {
+		t.Errorf("wrong culprit: got %q", report.Culprit)
+	}
+	if report.Stack[0].Function != report.Culprit {
+		t.Errorf("stack should start at the logging function, got %q", report.Stack[0].Function)
+	}
+	if report.Request == nil || report.Request.RequestID != "req-1" || report.User == nil || report.User.ID != "ama" {
+		t.Errorf("request and user not taken from attributes: %+v %+v", report.Request, report.User)
+	}
+	if report.Tags["table"] != "users" {
+		t.Errorf("attribute not added as tag: %v", report.Tags)
+	}
+}
@@ -0,0 +1,147 @@
+package errreport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Report kinds
+const (
+	KindPanic    = "panic"
+	KindResponse = "http_5xx"
+	KindLog      = "log"
+)
+
+const maxStackDepth = 64
+
+// Report describes one error, or several with the same fingerprint when
+// Count is above 1
+type Report struct {
+	ID          string            `json:"id"`
+	Fingerprint string            `json:"fingerprint"`
+	Kind        string            `json:"kind"`
+	Message     string            `json:"message"`
+	Culprit     string            `json:"culprit,omitempty"` // function the error came from
+	Timestamp   time.Time         `json:"timestamp"`
+	Count       int               `json:"count"` // occurrences since the fingerprint was last sent
+	Environment string            `json:"environment,omitempty"`
+	Stack       []Frame           `json:"stack,omitempty"` // innermost call first
+	Request     *Request          `json:"request,omitempty"`
+	User        *User             `json:"user,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// Request is the request being served when the error happened. Headers only
+// holds headers that cannot carry credentials.
+type Request struct {
+	Method    string            `json:"method"`
+	Path      string            `json:"path"`
+	Route     string            `json:"route,omitempty"`
+	Status    int               `json:"status,omitempty"`
+	ClientIP  string            `json:"client_ip,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+type User struct {
+	ID string `json:"id"`
+}
+
+// Stack returns the stack of the caller of Stack, skipping skip more frames
+func Stack(skip int) []Frame {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(skip+2, pcs)
+	return framesOf(pcs[:n])
+}
+
+// PanicStack returns the stack of the panic being recovered, starting at the
+// function that panicked. Call it from the deferred function.
+func PanicStack() []Frame {
+	frames := Stack(1)
+	for i, frame := range frames {
+		if frame.Function == "runtime.gopanic" {
+			return frames[i+1:]
+		}
+	}
+	return frames
+}
+
+func framesOf(pcs []uintptr) []Frame {
+	frames := make([]Frame, 0, len(pcs))
+	iter := runtime.CallersFrames(pcs)
+	for {
+		frame, more := iter.Next()
+		frames = append(frames, Frame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		if !more {
+			return frames
+		}
+	}
+}
+
+// packageOf returns the import path of a function name such as
+// github.com/org/repo/internal/users.(*Handler).Create
+func packageOf(function string) string {
+	slash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+		return function[:slash+1+dot]
+	}
+	return function
+}
+
+// trimPackages drops the leading frames from the given packages, such as
+// the helpers that captured the stack
+func trimPackages(frames []Frame, packages ...string) []Frame {
+	for len(frames) > 1 {
+		pkg := packageOf(frames[0].Function)
+		found := false
+		for _, p := range packages {
+			if pkg == p {
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+		frames = frames[1:]
+	}
+	return frames
+}
+
+// modulePath decides which frames are part of the application
+var modulePath = func() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Path
+	}
+	return ""
+}()
+
+func inApp(function string) bool {
+	return modulePath == "" || strings.HasPrefix(function, modulePath+"/") || strings.HasPrefix(function, "main.")
+}
+
+var (
+	uuidPattern   = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	numberPattern = regexp.MustCompile(`[0-9]+`)
+)
+
+// fingerprint groups reports of the same error. IDs and numbers are removed
+// from the message so that, for example, "user 42 not found" and "user 43
+// not found" are grouped.
+func fingerprint(report *Report) string {
+	message := uuidPattern.ReplaceAllString(report.Message, "<id>")
+	message = numberPattern.ReplaceAllString(message, "<n>")
+	sum := sha256.Sum256([]byte(report.Kind + "\n" + report.Culprit + "\n" + message))
+	return hex.EncodeToString(sum[:8])
+}
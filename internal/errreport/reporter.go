@@ -0,0 +1,302 @@
+package errreport
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/logger"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
+)
+
+const (
+	defaultQueueSize   = 256
+	defaultSendTimeout = 5 * time.Second
+	defaultGroupWindow = time.Minute
+	defaultRateLimit   = 60
+)
+
+type Config struct {
+	Enabled     bool              `yaml:"enabled"`
+	Environment string            `yaml:"environment"`
+	QueueSize   int               `yaml:"queue_size"`   // reports waiting to be sent, further reports are dropped
+	SendTimeout time.Duration     `yaml:"send_timeout"` // per sink
+	GroupWindow time.Duration     `yaml:"group_window"` // each fingerprint is sent at most once per window
+	RateLimit   int               `yaml:"rate_limit"`   // reports sent per minute across all fingerprints
+	Burst       int               `yaml:"burst"`        // reports sent at once before RateLimit applies, RateLimit when 0
+	File        FileSinkConfig    `yaml:"file"`
+	Webhook     WebhookSinkConfig `yaml:"webhook"`
+	Sentry      SentrySinkConfig  `yaml:"sentry"`
+}
+
+// group tracks one fingerprint between sends
+type group struct {
+	lastSent   time.Time
+	suppressed int
+}
+
+// Reporter groups reports by fingerprint and sends them to its sinks in the
+// background. A fingerprint seen again within GroupWindow is only counted,
+// and the count is sent with its next report. Reports beyond RateLimit or
+// the queue size are dropped.
+type Reporter struct {
+	cfg   Config
+	sinks []Sink
+	now   func() time.Time
+
+	mu     sync.Mutex
+	groups map[string]*group
+	tokens float64
+	filled time.Time
+	closed bool
+
+	queue chan *Report
+	done  chan struct{}
+}
+
+// New returns a reporter sending to the sinks configured in config
+func New(config *Config) (*Reporter, error) {
+	cfg := Config{}
+	if config != nil {
+		cfg = *config
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.SendTimeout <= 0 {
+		cfg.SendTimeout = defaultSendTimeout
+	}
+	if cfg.GroupWindow <= 0 {
+		cfg.GroupWindow = defaultGroupWindow
+	}
+	if cfg.RateLimit <= 0 {
+		cfg.RateLimit = defaultRateLimit
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = cfg.RateLimit
+	}
+
+	var sinks []Sink
+	if cfg.File.Path != "" {
+		sink, err := NewFileSink(&cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.Webhook.URL != "" {
+		sink, err := NewWebhookSink(&cfg.Webhook)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.Sentry.DSN != "" {
+		sink, err := NewSentrySink(&cfg.Sentry)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.Enabled && len(sinks) == 0 {
+		return nil, fmt.Errorf("error reporting is enabled but no sink is configured")
+	}
+
+	r := &Reporter{
+		cfg:    cfg,
+		sinks:  sinks,
+		now:    time.Now,
+		groups: make(map[string]*group),
+		tokens: float64(cfg.Burst),
+		queue:  make(chan *Report, cfg.QueueSize),
+		done:   make(chan struct{}),
+	}
+	go r.send()
+	return r, nil
+}
+
+// Report fills in the ID, time, culprit and fingerprint of report and queues
+// it, unless the fingerprint was sent within GroupWindow or the rate limit
+// is reached. A nil reporter drops every report.
+func (r *Reporter) Report(report *Report) {
+	if r == nil || !r.cfg.Enabled {
+		return
+	}
+	monitoring.ErrorReportsTotal.WithLabelValues(report.Kind).Inc()
+
+	report.ID = uuid.New().String()
+	if report.Timestamp.IsZero() {
+		report.Timestamp = r.now()
+	}
+	report.Environment = r.cfg.Environment
+	if report.Culprit == "" && len(report.Stack) > 0 {
+		report.Culprit = report.Stack[0].Function
+		for _, frame := range report.Stack {
+			if inApp(frame.Function) {
+				report.Culprit = frame.Function
+				break
+			}
+		}
+	}
+	report.Fingerprint = fingerprint(report)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		monitoring.ErrorReportsDroppedTotal.WithLabelValues("closed").Inc()
+		return
+	}
+
+	now := r.now()
+	g, ok := r.groups[report.Fingerprint]
+	if !ok {
+		r.pruneGroups(now)
+		g = &group{}
+		r.groups[report.Fingerprint] = g
+	}
+	if now.Sub(g.lastSent) < r.cfg.GroupWindow {
+		g.suppressed++
+		monitoring.ErrorReportsDroppedTotal.WithLabelValues("grouped").Inc()
+		return
+	}
+	if !r.take(now) {
+		g.suppressed++
+		monitoring.ErrorReportsDroppedTotal.WithLabelValues("rate_limited").Inc()
+		return
+	}
+
+	report.Count = g.suppressed + 1
+	select {
+	case r.queue <- report:
+		g.lastSent = now
+		g.suppressed = 0
+	default:
+		g.suppressed++
+		monitoring.ErrorReportsDroppedTotal.WithLabelValues("queue_full").Inc()
+	}
+}
+
+// take removes a token from the bucket refilled at RateLimit per minute,
+// r.mu must be held
+func (r *Reporter) take(now time.Time) bool {
+	if !r.filled.IsZero() {
+		elapsed := now.Sub(r.filled).Minutes()
+		r.tokens = min(float64(r.cfg.Burst), r.tokens+elapsed*float64(r.cfg.RateLimit))
+	}
+	r.filled = now
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// pruneGroups forgets fingerprints idle for a window with nothing left to
+// report, r.mu must be held
+func (r *Reporter) pruneGroups(now time.Time) {
+	for key, g := range r.groups {
+		if g.suppressed == 0 && now.Sub(g.lastSent) >= r.cfg.GroupWindow {
+			delete(r.groups, key)
+		}
+	}
+}
+
+func (r *Reporter) send() {
+	defer close(r.done)
+	for report := range r.queue {
+		for _, sink := range r.sinks {
+			ctx, cancel := context.WithTimeout(context.Background(), r.cfg.SendTimeout)
+			err := sink.Send(ctx, report)
+			cancel()
+			if err != nil {
+				// Warn, as an error would be reported again
+				monitoring.ErrorReportSinkErrorsTotal.WithLabelValues(sink.Name()).Inc()
+				logger.Warn("Failed to send error report %s to %s: %v", report.ID, sink.Name(), err)
+			}
+		}
+	}
+}
+
+// Close stops accepting reports, sends the queued ones and closes the sinks
+func (r *Reporter) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return fmt.Errorf("error reports not sent before shutdown: %w", ctx.Err())
+	}
+	for _, sink := range r.sinks {
+		sink.Close()
+	}
+	return nil
+}
+
+type skipKey struct{}
+
+// Skip returns a copy of ctx whose error log records are not reported, for
+// errors that are reported some other way
+func Skip(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipKey{}, true)
+}
+
+// LogHook reports records logged at error level, add it with logger.AddHook.
+// The request ID and user ID added to the context by the middleware are
+// attached to the report.
+func (r *Reporter) LogHook(ctx context.Context, record slog.Record) {
+	if skip, _ := ctx.Value(skipKey{}).(bool); skip {
+		return
+	}
+
+	report := &Report{
+		Kind:      KindLog,
+		Message:   record.Message,
+		Timestamp: record.Time,
+		Tags:      map[string]string{},
+	}
+	if record.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+		report.Culprit = frame.Function
+		report.Stack = Stack(0)
+		// Start the stack at the call to the logger
+		for i, f := range report.Stack {
+			if f.Function == frame.Function {
+				report.Stack = report.Stack[i:]
+				break
+			}
+		}
+	}
+	record.Attrs(func(a slog.Attr) bool {
+		switch a.Key {
+		case "request_id":
+			report.Request = &Request{RequestID: a.Value.String()}
+		case "user_id":
+			report.User = &User{ID: a.Value.String()}
+		default:
+			report.Tags[a.Key] = a.Value.String()
+		}
+		return true
+	})
+	r.Report(report)
+}
+
+// CallerStack returns the stack starting skip frames above the caller,
+// without the leading frames from the package of that first function, such
+// as response helpers calling each other.
+func CallerStack(skip int) []Frame {
+	frames := Stack(skip + 1)
+	if len(frames) > 0 {
+		frames = trimPackages(frames, packageOf(frames[0].Function))
+	}
+	return frames
+}
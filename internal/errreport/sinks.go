@@ -0,0 +1,229 @@
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink receives reports from a Reporter, one at a time
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, report *Report) error
+	Close() error
+}
+
+type FileSinkConfig struct {
+	Path string `yaml:"path"`
+}
+
+// FileSink appends each report to a file as a line of JSON
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileSink(config *FileSinkConfig) (*FileSink, error) {
+	if dir := filepath.Dir(config.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create error report directory: %w", err)
+		}
+	}
+	file, err := os.OpenFile(config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open error report file: %w", err)
+	}
+	return &FileSink{file: file}, nil
+}
+
+func (s *FileSink) Name() string { return "file" }
+
+func (s *FileSink) Send(ctx context.Context, report *Report) error {
+	line, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+type WebhookSinkConfig struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"` // such as Authorization
+}
+
+// WebhookSink posts each report as JSON
+type WebhookSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func NewWebhookSink(config *WebhookSinkConfig) (*WebhookSink, error) {
+	if _, err := url.ParseRequestURI(config.URL); err != nil {
+		return nil, fmt.Errorf("invalid error report webhook URL: %w", err)
+	}
+	return &WebhookSink{url: config.URL, headers: config.Headers, client: &http.Client{}}, nil
+}
+
+func (s *WebhookSink) Name() string { return "webhook" }
+
+func (s *WebhookSink) Send(ctx context.Context, report *Report) error {
+	return postJSON(ctx, s.client, s.url, s.headers, report)
+}
+
+func (s *WebhookSink) Close() error { return nil }
+
+type SentrySinkConfig struct {
+	DSN string `yaml:"dsn"` // scheme://key@host/project, set with SENTRY_DSN
+}
+
+// SentrySink sends reports to the store endpoint of a Sentry-compatible
+// server
+type SentrySink struct {
+	endpoint string
+	auth     string
+	client   *http.Client
+}
+
+func NewSentrySink(config *SentrySinkConfig) (*SentrySink, error) {
+	dsn, err := url.Parse(config.DSN)
+	if err != nil || dsn.User == nil || dsn.Host == "" {
+		return nil, fmt.Errorf("invalid Sentry DSN")
+	}
+	path := strings.TrimSuffix(dsn.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	project := path[slash+1:]
+	if project == "" {
+		return nil, fmt.Errorf("invalid Sentry DSN: missing project")
+	}
+
+	auth := "Sentry sentry_version=7, sentry_client=go-webserver/1.0, sentry_key=" + dsn.User.Username()
+	if secret, ok := dsn.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+	return &SentrySink{
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/store/", dsn.Scheme, dsn.Host, path[:slash], project),
+		auth:     auth,
+		client:   &http.Client{},
+	}, nil
+}
+
+func (s *SentrySink) Name() string { return "sentry" }
+
+func (s *SentrySink) Send(ctx context.Context, report *Report) error {
+	return postJSON(ctx, s.client, s.endpoint, map[string]string{"X-Sentry-Auth": s.auth}, sentryEvent(report))
+}
+
+func (s *SentrySink) Close() error { return nil }
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// sentryEvent converts report to the event format of the store endpoint
+func sentryEvent(report *Report) map[string]any {
+	level := "error"
+	if report.Kind == KindPanic {
+		level = "fatal"
+	}
+
+	// Sentry lists frames oldest call first
+	frames := make([]sentryFrame, 0, len(report.Stack))
+	for i := len(report.Stack) - 1; i >= 0; i-- {
+		frame := report.Stack[i]
+		frames = append(frames, sentryFrame{
+			Function: frame.Function,
+			Filename: frame.File,
+			Lineno:   frame.Line,
+			InApp:    inApp(frame.Function),
+		})
+	}
+
+	event := map[string]any{
+		"event_id":    strings.ReplaceAll(report.ID, "-", ""),
+		"timestamp":   report.Timestamp.UTC().Format(time.RFC3339),
+		"platform":    "go",
+		"level":       level,
+		"logger":      report.Kind,
+		"culprit":     report.Culprit,
+		"message":     report.Message,
+		"fingerprint": []string{report.Fingerprint},
+		"exception": map[string]any{
+			"values": []map[string]any{{
+				"type":       report.Kind,
+				"value":      report.Message,
+				"stacktrace": map[string]any{"frames": frames},
+			}},
+		},
+		"tags":  report.Tags,
+		"extra": map[string]any{"count": report.Count},
+	}
+	if report.Environment != "" {
+		event["environment"] = report.Environment
+	}
+	if host, err := os.Hostname(); err == nil {
+		event["server_name"] = host
+	}
+	if report.Request != nil {
+		event["request"] = map[string]any{
+			"method":  report.Request.Method,
+			"url":     report.Request.Path,
+			"headers": report.Request.Headers,
+		}
+	}
+	if report.User != nil {
+		user := map[string]any{"id": report.User.ID}
+		if report.Request != nil && report.Request.ClientIP != "" {
+			user["ip_address"] = report.Request.ClientIP
+		}
+		event["user"] = user
+	}
+	return event
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
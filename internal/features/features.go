@@ -0,0 +1,215 @@
+package features
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/db/database"
+)
+
+// Flag decides who sees a feature. A disabled flag is off for everyone. An
+// enabled flag is on for the listed users and roles, and for Rollout percent
+// of the remaining authenticated users; a Rollout of 100 turns it on for
+// anonymous requests as well.
+type Flag struct {
+	Name        string   `yaml:"name" json:"name"`
+	Description string   `yaml:"description" json:"description"`
+	Enabled     bool     `yaml:"enabled" json:"enabled"`
+	Rollout     int      `yaml:"rollout" json:"rollout"` // percentage 0-100
+	Users       []string `yaml:"users" json:"users"`
+	Roles       []string `yaml:"roles" json:"roles"`
+}
+
+// Validate checks the flag can be stored
+func (f *Flag) Validate() error {
+	if f.Name == "" {
+		return fmt.Errorf("flag name is required")
+	}
+	if f.Rollout < 0 || f.Rollout > 100 {
+		return fmt.Errorf("flag %s: rollout must be between 0 and 100, got %d", f.Name, f.Rollout)
+	}
+	return nil
+}
+
+// Subject is who a flag is evaluated for
+type Subject struct {
+	UserID string
+	Role   string
+}
+
+// On reports whether the flag is on for subject
+func (f *Flag) On(subject Subject) bool {
+	if !f.Enabled {
+		return false
+	}
+	if f.Rollout >= 100 {
+		return true
+	}
+	if subject.UserID != "" && slices.Contains(f.Users, subject.UserID) {
+		return true
+	}
+	if subject.Role != "" && slices.Contains(f.Roles, subject.Role) {
+		return true
+	}
+	if subject.UserID == "" || f.Rollout <= 0 {
+		return false
+	}
+	return bucket(f.Name, subject.UserID) < f.Rollout
+}
+
+// bucket places a user in 0-99, stable per flag so that raising the rollout
+// only ever adds users
+func bucket(flag, userID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(flag + ":" + userID))
+	return int(h.Sum32() % 100)
+}
+
+// Store persists flags changed at runtime
+type Store interface {
+	ListFlags(ctx context.Context) ([]Flag, error)
+	SaveFlag(ctx context.Context, flag Flag) error
+}
+
+// PostgresStore keeps flags in the feature_flags table
+type PostgresStore struct {
+	db *database.Queries
+}
+
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) ListFlags(ctx context.Context) ([]Flag, error) {
+	rows, err := s.db.ListFeatureFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	flags := make([]Flag, 0, len(rows))
+	for _, row := range rows {
+		flags = append(flags, Flag{
+			Name:        row.Name,
+			Description: row.Description,
+			Enabled:     row.Enabled,
+			Rollout:     int(row.Rollout),
+			Users:       row.Users,
+			Roles:       row.Roles,
+		})
+	}
+	return flags, nil
+}
+
+func (s *PostgresStore) SaveFlag(ctx context.Context, flag Flag) error {
+	users, roles := flag.Users, flag.Roles
+	if users == nil {
+		users = []string{}
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+	_, err := s.db.UpsertFeatureFlag(ctx, database.UpsertFeatureFlagParams{
+		Name:        flag.Name,
+		Description: flag.Description,
+		Enabled:     flag.Enabled,
+		Rollout:     int32(flag.Rollout),
+		Users:       users,
+		Roles:       roles,
+	})
+	return err
+}
+
+// Service evaluates flags. Flags from config.yaml are the defaults and
+// flags in the store, which the admin API writes, override them.
+type Service struct {
+	mu       sync.RWMutex
+	defaults map[string]Flag
+	flags    map[string]Flag
+	store    Store
+}
+
+// NewService returns a service with the given default flags, store may be nil
+func NewService(defaults []Flag, store Store) (*Service, error) {
+	s := &Service{
+		defaults: make(map[string]Flag),
+		flags:    make(map[string]Flag),
+		store:    store,
+	}
+	for _, flag := range defaults {
+		if err := flag.Validate(); err != nil {
+			return nil, err
+		}
+		s.defaults[flag.Name] = flag
+		s.flags[flag.Name] = flag
+	}
+	return s, nil
+}
+
+// Load reads the store and applies its flags over the defaults
+func (s *Service) Load(ctx context.Context) error {
+	if s.store == nil {
+		return nil
+	}
+	stored, err := s.store.ListFlags(ctx)
+	if err != nil {
+		return fmt.Errorf("loading feature flags: %w", err)
+	}
+
+	flags := make(map[string]Flag, len(s.defaults)+len(stored))
+	for name, flag := range s.defaults {
+		flags[name] = flag
+	}
+	for _, flag := range stored {
+		flags[flag.Name] = flag
+	}
+
+	s.mu.Lock()
+	s.flags = flags
+	s.mu.Unlock()
+	return nil
+}
+
+// Set validates, persists and applies a flag
+func (s *Service) Set(ctx context.Context, flag Flag) error {
+	if err := flag.Validate(); err != nil {
+		return err
+	}
+	if s.store != nil {
+		if err := s.store.SaveFlag(ctx, flag); err != nil {
+			return fmt.Errorf("saving feature flag %s: %w", flag.Name, err)
+		}
+	}
+	s.mu.Lock()
+	s.flags[flag.Name] = flag
+	s.mu.Unlock()
+	return nil
+}
+
+// Get returns a flag by name
+func (s *Service) Get(name string) (Flag, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	flag, ok := s.flags[name]
+	return flag, ok
+}
+
+// Flags returns every flag sorted by name
+func (s *Service) Flags() []Flag {
+	s.mu.RLock()
+	flags := make([]Flag, 0, len(s.flags))
+	for _, flag := range s.flags {
+		flags = append(flags, flag)
+	}
+	s.mu.RUnlock()
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags
+}
+
+// IsEnabled reports whether the named flag is on for subject, unknown flags are off
+func (s *Service) IsEnabled(name string, subject Subject) bool {
+	flag, ok := s.Get(name)
+	return ok && flag.On(subject)
+}
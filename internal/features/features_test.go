@@ -0,0 +1,140 @@
+package features
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFlagOn(t *testing.T) {
+	tests := []struct {
+		name     string
+		flag     Flag
+		subject  Subject
+		expected bool
+	}{
+		{name: "Disabled", flag: Flag{Name: "f", Rollout: 100, Users: []string{"ama"}}, subject: Subject{UserID: "ama"}, expected: false},
+		{name: "Targeted User", flag: Flag{Name: "f", Enabled: true, Users: []string{"ama"}}, subject: Subject{UserID: "ama"}, expected: true},
+		{name: "Other User", flag: Flag{Name: "f", Enabled: true, Users: []string{"ama"}}, subject: Subject{UserID: "kofi"}, expected: false},
+		{name: "Targeted Role", flag: Flag{Name: "f", Enabled: true, Roles: []string{"admin"}}, subject: Subject{UserID: "kofi", Role: "admin"}, expected: true},
+		{name: "Full Rollout Anonymous", flag: Flag{Name: "f", Enabled: true, Rollout: 100}, subject: Subject{}, expected: true},
+		{name: "Partial Rollout Anonymous", flag: Flag{Name: "f", Enabled: true, Rollout: 99}, subject: Subject{}, expected: false},
+		{name: "Enabled Without Targets", flag: Flag{Name: "f", Enabled: true}, subject: Subject{UserID: "ama"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.flag.On(tt.subject); got != tt.expected {
+				t.Errorf("On returned %t, want %t", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRollout(t *testing.T) {
+	users := make([]string, 1000)
+	for i := range users {
+		users[i] = fmt.Sprintf("user-%d", i)
+	}
+
+	count := func(flag Flag) map[string]bool {
+		on := make(map[string]bool)
+		for _, user := range users {
+			if flag.On(Subject{UserID: user}) {
+				on[user] = true
+			}
+		}
+		return on
+	}
+
+	ten := count(Flag{Name: "new-ui", Enabled: true, Rollout: 10})
+	fifty := count(Flag{Name: "new-ui", Enabled: true, Rollout: 50})
+
+	if len(ten) < 50 || len(ten) > 150 {
+		t.Errorf("10%% rollout enabled %d of %d users", len(ten), len(users))
+	}
+	if len(fifty) < 400 || len(fifty) > 600 {
+		t.Errorf("50%% rollout enabled %d of %d users", len(fifty), len(users))
+	}
+	for user := range ten {
+		if !fifty[user] {
+			t.Errorf("raising the rollout disabled %s", user)
+		}
+	}
+}
+
+type memoryStore struct {
+	flags map[string]Flag
+	err   error
+}
+
+func (s *memoryStore) ListFlags(ctx context.Context) ([]Flag, error) {
+	var flags []Flag
+	for _, flag := range s.flags {
+		flags = append(flags, flag)
+	}
+	return flags, s.err
+}
+
+func (s *memoryStore) SaveFlag(ctx context.Context, flag Flag) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.flags[flag.Name] = flag
+	return nil
+}
+
+func TestService(t *testing.T) {
+	store := &memoryStore{flags: map[string]Flag{
+		"search": {Name: "search", Enabled: true, Rollout: 100},
+	}}
+	service, err := NewService([]Flag{
+		{Name: "search", Enabled: false},
+		{Name: "exports", Enabled: true, Roles: []string{"admin"}},
+	}, store)
+	if err != nil {
+		t.Fatalf("NewService returned error: %v", err)
+	}
+
+	if service.IsEnabled("search", Subject{}) {
+		t.Error("search should follow the config default before Load")
+	}
+	if err := service.Load(context.Background()); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if !service.IsEnabled("search", Subject{}) {
+		t.Error("stored flag did not override the config default")
+	}
+	if !service.IsEnabled("exports", Subject{Role: "admin"}) {
+		t.Error("config flag missing after Load")
+	}
+	if service.IsEnabled("unknown", Subject{UserID: "ama"}) {
+		t.Error("unknown flag should be off")
+	}
+
+	if err := service.Set(context.Background(), Flag{Name: "exports", Enabled: false}); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	if service.IsEnabled("exports", Subject{Role: "admin"}) {
+		t.Error("Set did not apply")
+	}
+	if _, ok := store.flags["exports"]; !ok {
+		t.Error("Set did not persist the flag")
+	}
+
+	if err := service.Set(context.Background(), Flag{Name: "exports", Rollout: 101}); err == nil {
+		t.Error("Expected error for invalid rollout")
+	}
+	store.err = errors.New("database down")
+	if err := service.Set(context.Background(), Flag{Name: "search", Enabled: false}); err == nil {
+		t.Error("Expected error when the store fails")
+	}
+	if !service.IsEnabled("search", Subject{}) {
+		t.Error("failed Set changed the flag")
+	}
+
+	if flags := service.Flags(); len(flags) != 2 || flags[0].Name != "exports" {
+		t.Errorf("Flags returned %v", flags)
+	}
+}
@@ -0,0 +1,230 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/utils"
+)
+
+// Probe is the kind of health question a check answers
+type Probe string
+
+const (
+	// Liveness fails only when the process must be restarted, it must not
+	// depend on other services
+	Liveness Probe = "liveness"
+	// Readiness fails while the instance should not receive traffic
+	Readiness Probe = "readiness"
+	// Startup fails until the instance has finished starting
+	Startup Probe = "startup"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+
+	defaultCheckTimeout = 2 * time.Second
+)
+
+// CheckFunc returns nil when the dependency is healthy
+type CheckFunc func(ctx context.Context) error
+
+// CheckConfig tunes a registered check
+type CheckConfig struct {
+	Timeout  time.Duration `yaml:"timeout"`   // per run, 2s when zero
+	CacheTTL time.Duration `yaml:"cache_ttl"` // how long a result is reused, zero runs the check on every probe
+	Disabled bool          `yaml:"disabled"`
+}
+
+type Config struct {
+	Checks map[string]CheckConfig `yaml:"checks"` // by check name
+	// ShutdownDelay keeps serving after readiness turns false on shutdown,
+	// giving load balancers time to stop sending traffic
+	ShutdownDelay time.Duration `yaml:"shutdown_delay"`
+}
+
+// CheckResult is one check in a probe report
+type CheckResult struct {
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+	Cached     bool      `json:"cached,omitempty"`
+}
+
+// Report is the JSON body of a probe endpoint
+type Report struct {
+	Probe  Probe         `json:"probe"`
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+type check struct {
+	name    string
+	fn      CheckFunc
+	timeout time.Duration
+	ttl     time.Duration
+
+	mu   sync.Mutex // held while running so concurrent probes share one run
+	last CheckResult
+}
+
+func (c *check) run(parent context.Context) CheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl > 0 && !c.last.CheckedAt.IsZero() && time.Since(c.last.CheckedAt) < c.ttl {
+		result := c.last
+		result.Cached = true
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(parent, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() { errc <- c.fn(ctx) }()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		// The check may not honour ctx, don't wait for it
+		err = ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = errors.New("timed out after " + c.timeout.String())
+	}
+
+	result := CheckResult{
+		Name:       c.name,
+		Status:     StatusOK,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		CheckedAt:  start,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	// A probe that went away says nothing about the dependency
+	if parent.Err() == nil {
+		c.last = result
+	}
+	return result
+}
+
+// Registry holds the checks behind /livez, /readyz and /startupz
+type Registry struct {
+	config       Config
+	mu           sync.RWMutex
+	checks       map[Probe][]*check
+	started      atomic.Bool
+	shuttingDown atomic.Bool
+}
+
+// NewRegistry returns a registry whose readiness and startup probes fail
+// until MarkStarted is called. config may be nil.
+func NewRegistry(config *Config) *Registry {
+	r := &Registry{checks: make(map[Probe][]*check)}
+	if config != nil {
+		r.config = *config
+	}
+
+	started := func(ctx context.Context) error {
+		if !r.started.Load() {
+			return errors.New("server is starting")
+		}
+		return nil
+	}
+	r.Register(Startup, "started", started)
+	r.Register(Readiness, "started", started)
+	r.Register(Readiness, "shutdown", func(ctx context.Context) error {
+		if r.shuttingDown.Load() {
+			return errors.New("server is shutting down")
+		}
+		return nil
+	})
+	return r
+}
+
+// Register adds a check to a probe, with the timeout and caching configured
+// for its name. Checks disabled in config are skipped.
+func (r *Registry) Register(probe Probe, name string, fn CheckFunc) {
+	cfg := r.config.Checks[name]
+	if cfg.Disabled {
+		return
+	}
+	c := &check{name: name, fn: fn, timeout: cfg.Timeout, ttl: cfg.CacheTTL}
+	if c.timeout <= 0 {
+		c.timeout = defaultCheckTimeout
+	}
+
+	r.mu.Lock()
+	r.checks[probe] = append(r.checks[probe], c)
+	r.mu.Unlock()
+}
+
+// MarkStarted lets the startup and readiness probes pass
+func (r *Registry) MarkStarted() {
+	r.started.Store(true)
+}
+
+// Shutdown turns readiness false so traffic drains before the server stops,
+// it returns after the configured shutdown delay
+func (r *Registry) Shutdown(ctx context.Context) {
+	r.shuttingDown.Store(true)
+	if r.config.ShutdownDelay <= 0 {
+		return
+	}
+	timer := time.NewTimer(r.config.ShutdownDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// Run runs the checks of a probe concurrently
+func (r *Registry) Run(ctx context.Context, probe Probe) Report {
+	r.mu.RLock()
+	checks := r.checks[probe]
+	r.mu.RUnlock()
+
+	report := Report{Probe: probe, Status: StatusOK, Checks: make([]CheckResult, len(checks))}
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+// Handler serves the report of a probe, with 503 when any check fails
+func (r *Registry) Handler(probe Probe) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		report := r.Run(req.Context(), probe)
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		utils.RespondWithJSON(w, status, report)
+	}
+}
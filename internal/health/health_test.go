@@ -0,0 +1,111 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProbes(t *testing.T) {
+	registry := NewRegistry(&Config{
+		Checks: map[string]CheckConfig{
+			"slow":     {Timeout: 20 * time.Millisecond},
+			"disabled": {Disabled: true},
+		},
+	})
+	var dbDown atomic.Bool
+	registry.Register(Readiness, "postgres", func(ctx context.Context) error {
+		if dbDown.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	registry.Register(Readiness, "disabled", func(ctx context.Context) error {
+		return errors.New("should not run")
+	})
+	registry.Register(Startup, "slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	serve := func(probe Probe) (int, Report) {
+		rr := httptest.NewRecorder()
+		registry.Handler(probe).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		var report Report
+		if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+			t.Fatalf("Could not decode report: %v", err)
+		}
+		return rr.Code, report
+	}
+	failed := func(report Report) map[string]string {
+		errs := make(map[string]string)
+		for _, check := range report.Checks {
+			if check.Status != StatusOK {
+				errs[check.Name] = check.Error
+			}
+		}
+		return errs
+	}
+
+	if code, _ := serve(Liveness); code != http.StatusOK {
+		t.Errorf("liveness returned wrong status code: got %v want %v", code, http.StatusOK)
+	}
+	if code, report := serve(Readiness); code != http.StatusServiceUnavailable || failed(report)["started"] == "" {
+		t.Errorf("readiness passed before start: %v %+v", code, report)
+	}
+
+	registry.MarkStarted()
+	code, report := serve(Readiness)
+	if code != http.StatusOK {
+		t.Errorf("readiness returned wrong status code: got %v want %v, %+v", code, http.StatusOK, report)
+	}
+	for _, check := range report.Checks {
+		if check.Name == "disabled" {
+			t.Error("disabled check was registered")
+		}
+	}
+
+	code, report = serve(Startup)
+	if code != http.StatusServiceUnavailable || failed(report)["slow"] != "timed out after 20ms" {
+		t.Errorf("slow startup check did not time out: %v %+v", code, report)
+	}
+
+	dbDown.Store(true)
+	if code, report := serve(Readiness); code != http.StatusServiceUnavailable || failed(report)["postgres"] != "connection refused" {
+		t.Errorf("readiness ignored a failing check: %v %+v", code, report)
+	}
+	dbDown.Store(false)
+
+	registry.Shutdown(context.Background())
+	if code, report := serve(Readiness); code != http.StatusServiceUnavailable || failed(report)["shutdown"] == "" {
+		t.Errorf("readiness passed while shutting down: %v %+v", code, report)
+	}
+	if code, _ := serve(Liveness); code != http.StatusOK {
+		t.Errorf("liveness failed while shutting down: got %v want %v", code, http.StatusOK)
+	}
+}
+
+func TestCheckCaching(t *testing.T) {
+	registry := NewRegistry(&Config{
+		Checks: map[string]CheckConfig{"s3": {CacheTTL: time.Minute}},
+	})
+	var runs atomic.Int32
+	registry.Register(Liveness, "s3", func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+
+	first := registry.Run(context.Background(), Liveness)
+	second := registry.Run(context.Background(), Liveness)
+	if runs.Load() != 1 {
+		t.Errorf("check ran %d times, want 1", runs.Load())
+	}
+	if first.Checks[0].Cached || !second.Checks[0].Cached {
+		t.Errorf("wrong cached flags: first %v, second %v", first.Checks[0].Cached, second.Checks[0].Cached)
+	}
+}
@@ -0,0 +1,118 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+type attrsKey struct{}
+
+// WithAttrs returns a copy of ctx whose log records get the given key-value
+// pairs, e.g. WithAttrs(ctx, "request_id", id)
+func WithAttrs(ctx context.Context, args ...any) context.Context {
+	record := slog.Record{}
+	record.Add(args...)
+	existing, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	attrs := make([]slog.Attr, 0, len(existing)+record.NumAttrs())
+	attrs = append(attrs, existing...)
+	record.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// Hook receives every record logged at error level, with the attributes
+// stored in ctx
+type Hook func(ctx context.Context, record slog.Record)
+
+var (
+	hooksMu sync.RWMutex
+	hooks   []Hook
+)
+
+// AddHook calls hook for every record logged at error level. Hooks must not
+// log at error level themselves.
+func AddHook(hook Hook) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, hook)
+}
+
+func runHooks(ctx context.Context, record slog.Record) {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	for _, hook := range hooks {
+		hook(ctx, record.Clone())
+	}
+}
+
+// contextHandler adds the attributes stored by WithAttrs to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func newContextHandler(h slog.Handler) *contextHandler {
+	return &contextHandler{Handler: h}
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok && len(attrs) > 0 {
+		record = record.Clone()
+		record.AddAttrs(attrs...)
+	}
+	if record.Level >= slog.LevelError {
+		runHooks(ctx, record)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// fanout sends each record to every handler that accepts its level
+type fanout []slog.Handler
+
+func (f fanout) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanout) Handle(ctx context.Context, record slog.Record) error {
+	var firstErr error
+	for _, h := range f {
+		if !h.Enabled(ctx, record.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, record.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (f fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(fanout, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (f fanout) WithGroup(name string) slog.Handler {
+	handlers := make(fanout, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
@@ -0,0 +1,255 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Runtime level overrides. The key "" overrides the global level, any other
+// key overrides the packages it names: a full import path, or trailing path
+// segments such as "internal/middleware" or "middleware", which also cover
+// subpackages. The most specific key wins.
+var (
+	levelsMu  sync.Mutex
+	baseLevel = slog.LevelInfo // set by Init
+	overrides = map[string]*levelOverride{}
+	nextID    uint64
+
+	// minLevel is the lowest level any package logs at, records below it
+	// are dropped before they are built
+	minLevel = new(slog.LevelVar)
+	// packageLevels is read for every record, it is replaced on each change
+	packageLevels atomic.Pointer[map[string]slog.Level]
+	packageCache  sync.Map // pc -> package path
+)
+
+type levelOverride struct {
+	id        uint64
+	level     slog.Level
+	expiresAt time.Time
+	timer     *time.Timer
+}
+
+// LevelSetting describes the global level or a package override
+type LevelSetting struct {
+	Package   string     `json:"package,omitempty"` // empty for the global level
+	Level     string     `json:"level"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // when the override reverts
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", s)
+}
+
+// SetLevel overrides the level of pkg, or the global level when pkg is
+// empty, until ttl has passed. The change and its revert are logged
+// whatever the new level is.
+func SetLevel(ctx context.Context, pkg string, lvl slog.Level, ttl time.Duration) LevelSetting {
+	levelsMu.Lock()
+	if old, ok := overrides[pkg]; ok {
+		old.timer.Stop()
+	}
+	nextID++
+	id := nextID
+	o := &levelOverride{id: id, level: lvl, expiresAt: time.Now().Add(ttl)}
+	o.timer = time.AfterFunc(ttl, func() { expireLevel(pkg, id) })
+	overrides[pkg] = o
+	applyLevels()
+	setting := settingFor(pkg, o)
+	levelsMu.Unlock()
+
+	logAlways(ctx, "log level changed", "package", displayPackage(pkg), "level", lvl.String(), "ttl", ttl.String())
+	return setting
+}
+
+// ResetLevel removes the override of pkg, it reports whether there was one
+func ResetLevel(ctx context.Context, pkg string) bool {
+	levelsMu.Lock()
+	o, ok := overrides[pkg]
+	if ok {
+		o.timer.Stop()
+		delete(overrides, pkg)
+		applyLevels()
+	}
+	levelsMu.Unlock()
+
+	if ok {
+		logAlways(ctx, "log level reset", "package", displayPackage(pkg))
+	}
+	return ok
+}
+
+func expireLevel(pkg string, id uint64) {
+	levelsMu.Lock()
+	o, ok := overrides[pkg]
+	if !ok || o.id != id {
+		// Replaced or reset since
+		levelsMu.Unlock()
+		return
+	}
+	delete(overrides, pkg)
+	applyLevels()
+	levelsMu.Unlock()
+
+	logAlways(context.Background(), "log level override expired", "package", displayPackage(pkg), "level", o.level.String())
+}
+
+// Levels returns the global level followed by the package overrides
+func Levels() []LevelSetting {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	settings := []LevelSetting{{Level: level.Level().String()}}
+	if o, ok := overrides[""]; ok {
+		settings[0] = settingFor("", o)
+	}
+	packages := make([]string, 0, len(overrides))
+	for pkg := range overrides {
+		if pkg != "" {
+			packages = append(packages, pkg)
+		}
+	}
+	sort.Strings(packages)
+	for _, pkg := range packages {
+		settings = append(settings, settingFor(pkg, overrides[pkg]))
+	}
+	return settings
+}
+
+func settingFor(pkg string, o *levelOverride) LevelSetting {
+	expiresAt := o.expiresAt
+	return LevelSetting{Package: pkg, Level: o.level.String(), ExpiresAt: &expiresAt}
+}
+
+func displayPackage(pkg string) string {
+	if pkg == "" {
+		return "all"
+	}
+	return pkg
+}
+
+// setBaseLevel sets the global level used when there is no override
+func setBaseLevel(lvl slog.Level) {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+	baseLevel = lvl
+	applyLevels()
+}
+
+// applyLevels recomputes the effective levels, levelsMu must be held
+func applyLevels() {
+	global := baseLevel
+	if o, ok := overrides[""]; ok {
+		global = o.level
+	}
+	level.Set(global)
+
+	lowest := global
+	packages := make(map[string]slog.Level, len(overrides))
+	for pkg, o := range overrides {
+		if pkg == "" {
+			continue
+		}
+		packages[pkg] = o.level
+		lowest = min(lowest, o.level)
+	}
+	minLevel.Set(lowest)
+	packageLevels.Store(&packages)
+}
+
+// levelFor returns the level records logged from pc are filtered at
+func levelFor(pc uintptr) slog.Level {
+	packages := packageLevels.Load()
+	if packages == nil || len(*packages) == 0 {
+		return level.Level()
+	}
+
+	pkg := packageOf(pc)
+	lvl, matched := level.Level(), -1
+	for key, override := range *packages {
+		if (pkg == key || strings.Contains("/"+pkg+"/", "/"+key+"/")) && len(key) > matched {
+			lvl, matched = override, len(key)
+		}
+	}
+	return lvl
+}
+
+// packageOf returns the import path of the function containing pc
+func packageOf(pc uintptr) string {
+	if pc == 0 {
+		return ""
+	}
+	if pkg, ok := packageCache.Load(pc); ok {
+		return pkg.(string)
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	// e.g. github.com/org/repo/internal/middleware.(*accessLogger).log
+	name := frame.Function
+	slash := strings.LastIndex(name, "/")
+	pkg := name
+	if dot := strings.Index(name[slash+1:], "."); dot >= 0 {
+		pkg = name[:slash+1+dot]
+	}
+	packageCache.Store(pc, pkg)
+	return pkg
+}
+
+// levelHandler drops records below the level of the package logging them
+// and adds the attributes stored in the context
+type levelHandler struct {
+	next slog.Handler
+}
+
+func newLevelHandler(h slog.Handler) *levelHandler {
+	return &levelHandler{next: newContextHandler(h)}
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, lvl slog.Level) bool {
+	return lvl >= minLevel.Level()
+}
+
+func (h *levelHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level < levelFor(record.PC) {
+		return nil
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{next: h.next.WithAttrs(attrs)}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{next: h.next.WithGroup(name)}
+}
+
+// logAlways logs at info level even when the level is set higher
+func logAlways(ctx context.Context, msg string, args ...any) {
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // skip Callers, logAlways and the level function
+	record := slog.NewRecord(time.Now(), slog.LevelInfo, msg, pcs[0])
+	record.Add(args...)
+	handler := std.Handler()
+	if filtered, ok := handler.(*levelHandler); ok {
+		handler = filtered.next
+	}
+	handler.Handle(ctx, record)
+}
@@ -0,0 +1,171 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is written by expiry timers while tests read it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs sends records to a buffer with the global level at info
+func captureLogs(t *testing.T) *syncBuffer {
+	t.Helper()
+	buf := &syncBuffer{}
+	old := std
+	std = slog.New(newLevelHandler(slog.NewJSONHandler(buf, handlerOptions())))
+	setBaseLevel(slog.LevelInfo)
+	t.Cleanup(func() {
+		for _, setting := range Levels() {
+			ResetLevel(context.Background(), setting.Package)
+		}
+		std = old
+	})
+	return buf
+}
+
+func TestSetLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		pkg     string
+		level   slog.Level
+		logged  bool
+		overall string
+	}{
+		{name: "Global", pkg: "", level: slog.LevelDebug, logged: true, overall: "DEBUG"},
+		{name: "Full import path", pkg: "github.com/NhyiraAmofaSekyi/go-webserver/internal/logger", level: slog.LevelDebug, logged: true, overall: "INFO"},
+		{name: "Trailing segments", pkg: "internal/logger", level: slog.LevelDebug, logged: true, overall: "INFO"},
+		{name: "Package name", pkg: "logger", level: slog.LevelDebug, logged: true, overall: "INFO"},
+		{name: "Other package", pkg: "middleware", level: slog.LevelDebug, logged: false, overall: "INFO"},
+		{name: "Partial name", pkg: "log", level: slog.LevelDebug, logged: false, overall: "INFO"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLogs(t)
+			SetLevel(context.Background(), tt.pkg, tt.level, time.Minute)
+			Debug("debug message")
+
+			if logged := strings.Contains(buf.String(), "debug message"); logged != tt.logged {
+				t.Errorf("debug message logged: got %v want %v", logged, tt.logged)
+			}
+			if !strings.Contains(buf.String(), `"msg":"log level changed"`) {
+				t.Errorf("change was not logged: %s", buf.String())
+			}
+			if got := Levels()[0].Level; got != tt.overall {
+				t.Errorf("wrong global level: got %v want %v", got, tt.overall)
+			}
+		})
+	}
+}
+
+func TestMostSpecificLevelWins(t *testing.T) {
+	buf := captureLogs(t)
+	SetLevel(context.Background(), "internal", slog.LevelDebug, time.Minute)
+	SetLevel(context.Background(), "internal/logger", slog.LevelError, time.Minute)
+
+	Warn("warn message")
+	if strings.Contains(buf.String(), "warn message") {
+		t.Error("warn message logged below the internal/logger override")
+	}
+
+	settings := Levels()
+	if len(settings) != 3 || settings[1].Package != "internal" || settings[2].Package != "internal/logger" {
+		t.Fatalf("wrong settings: %+v", settings)
+	}
+	if settings[2].Level != "ERROR" || settings[2].ExpiresAt == nil {
+		t.Errorf("wrong override: %+v", settings[2])
+	}
+}
+
+func TestChangesLoggedAboveLevel(t *testing.T) {
+	buf := captureLogs(t)
+	SetLevel(context.Background(), "", slog.LevelError, time.Minute)
+	Info("info message")
+	ResetLevel(WithAttrs(context.Background(), "user_id", "ama"), "")
+
+	output := buf.String()
+	if strings.Contains(output, "info message") {
+		t.Error("info message logged at error level")
+	}
+	for _, want := range []string{`"msg":"log level changed"`, `"level":"ERROR"`, `"msg":"log level reset"`, `"user_id":"ama"`} {
+		if !strings.Contains(output, want) {
+			t.Errorf("logs do not contain %s: %s", want, output)
+		}
+	}
+	if got := Levels()[0].Level; got != "INFO" {
+		t.Errorf("wrong level after reset: got %v want INFO", got)
+	}
+}
+
+func TestLevelExpires(t *testing.T) {
+	buf := captureLogs(t)
+	SetLevel(context.Background(), "logger", slog.LevelDebug, 20*time.Millisecond)
+	// Replacing the override restarts its TTL
+	SetLevel(context.Background(), "logger", slog.LevelDebug, 100*time.Millisecond)
+
+	time.Sleep(50 * time.Millisecond)
+	if len(Levels()) != 2 {
+		t.Fatal("override expired with the TTL it replaced")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(buf.String(), `"msg":"log level override expired"`) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expiry was not logged: %s", buf.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(Levels()) != 1 {
+		t.Errorf("override still set after expiring: %+v", Levels())
+	}
+	Debug("debug message")
+	if strings.Contains(buf.String(), "debug message") {
+		t.Error("debug message logged after the override expired")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    slog.Level
+		wantErr bool
+	}{
+		{input: "debug", want: slog.LevelDebug},
+		{input: "INFO", want: slog.LevelInfo},
+		{input: "warn", want: slog.LevelWarn},
+		{input: "error", want: slog.LevelError},
+		{input: "trace", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseLevel(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLevel(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseLevel(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,73 +1,156 @@
 package logger
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"time"
 )
 
-type Logger struct {
-	debug   *log.Logger
-	info    *log.Logger
-	error   *log.Logger
-	isDebug bool
-}
+// level is the global level, set by Init and changed at runtime by SetLevel
+var level = new(slog.LevelVar)
 
-var std *Logger
+// std logs to stderr until Init is called
+var std = slog.New(newLevelHandler(slog.NewTextHandler(os.Stderr, handlerOptions())))
 
-const (
-	colorRed    = "\033[31m"
-	colorGreen  = "\033[32m"
-	colorYellow = "\033[33m"
-	colorReset  = "\033[0m"
-)
+// file is the current log file, replaced by every Init
+var file *RotatingFile
 
+// Init logs to stdout and to logs/server_<date>.log, see InitWithConfig
 func Init(debugMode bool) {
-	err := os.MkdirAll("logs", 0755)
+	InitWithConfig(debugMode, nil)
+}
+
+// InitWithConfig logs to stdout and to a daily, rotated file configured by
+// config, which may be nil. The file is always JSON, stdout is JSON unless
+// it is a terminal. The standard library log package is routed through the
+// same handlers.
+func InitWithConfig(debugMode bool, config *FileConfig) {
+	rotating, err := NewRotatingFile(config)
 	if err != nil {
-		log.Fatalf("Failed to create logs directory: %v", err)
+		log.Fatalf("Failed to open log file: %v", err)
 	}
+	if file != nil {
+		file.Close()
+	}
+	file = rotating
 
-	file, err := os.OpenFile(
-		fmt.Sprintf("logs/server_%s.log", time.Now().Format("2006-01-02")),
-		os.O_APPEND|os.O_CREATE|os.O_WRONLY,
-		0666,
-	)
-	if err != nil {
-		log.Fatal(err)
+	if debugMode {
+		setBaseLevel(slog.LevelDebug)
+	} else {
+		setBaseLevel(slog.LevelInfo)
 	}
 
-	// Write to both file and stdout
-	multiWriter := io.MultiWriter(os.Stdout, file)
+	opts := handlerOptions()
+	var console slog.Handler = slog.NewJSONHandler(os.Stdout, opts)
+	if isTerminal(os.Stdout) {
+		console = slog.NewTextHandler(os.Stdout, opts)
+	}
+	std = slog.New(newLevelHandler(fanout{console, slog.NewJSONHandler(file, opts)}))
+	slog.SetDefault(std)
+}
 
-	// Common flags for all loggers
-	const flags = log.Ldate | log.Ltime | log.Lshortfile
+// Reopen reopens the log file, call it on SIGHUP after logrotate moved the file
+func Reopen() error {
+	if file == nil {
+		return nil
+	}
+	return file.Reopen()
+}
 
-	std = &Logger{
-		debug:   log.New(multiWriter, colorYellow+"DEBUG: "+colorReset, flags),
-		info:    log.New(multiWriter, colorGreen+"INFO: "+colorReset, flags),
-		error:   log.New(multiWriter, colorRed+"ERROR: "+colorReset, flags),
-		isDebug: debugMode,
+func handlerOptions() *slog.HandlerOptions {
+	return &slog.HandlerOptions{
+		// Levels are filtered per package by levelHandler
+		Level:     slog.LevelDebug,
+		AddSource: true,
+		// Print the caller as file:line like log.Lshortfile did
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.SourceKey && len(groups) == 0 {
+				if source, ok := a.Value.Any().(*slog.Source); ok {
+					a.Value = slog.StringValue(filepath.Base(source.File) + ":" + strconv.Itoa(source.Line))
+				}
+			}
+			return a
+		},
 	}
 }
 
-func Debug(format string, v ...interface{}) {
-	if std.isDebug {
-		std.debug.Output(2, fmt.Sprintf(format, v...))
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Logger returns the underlying structured logger
+func Logger() *slog.Logger {
+	return std
+}
+
+// logf logs a printf style message with the caller of the exported function as source
+func logf(ctx context.Context, lvl slog.Level, format string, v ...interface{}) {
+	if !std.Enabled(ctx, lvl) {
+		return
 	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // skip Callers, logf and the exported function
+	record := slog.NewRecord(time.Now(), lvl, fmt.Sprintf(format, v...), pcs[0])
+	std.Handler().Handle(ctx, record)
+}
+
+// logAttrs logs msg with key-value pairs and the attributes stored in ctx
+func logAttrs(ctx context.Context, lvl slog.Level, msg string, args ...any) {
+	if !std.Enabled(ctx, lvl) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	record := slog.NewRecord(time.Now(), lvl, msg, pcs[0])
+	record.Add(args...)
+	std.Handler().Handle(ctx, record)
+}
+
+func Debug(format string, v ...interface{}) {
+	logf(context.Background(), slog.LevelDebug, format, v...)
 }
 
 func Info(format string, v ...interface{}) {
-	std.info.Output(2, fmt.Sprintf(format, v...))
+	logf(context.Background(), slog.LevelInfo, format, v...)
+}
+
+func Warn(format string, v ...interface{}) {
+	logf(context.Background(), slog.LevelWarn, format, v...)
 }
 
 func Error(format string, v ...interface{}) {
-	std.error.Output(2, fmt.Sprintf(format, v...))
+	logf(context.Background(), slog.LevelError, format, v...)
 }
 
 func Fatal(format string, v ...interface{}) {
-	std.error.Output(2, fmt.Sprintf(format, v...))
+	logf(context.Background(), slog.LevelError, format, v...)
 	os.Exit(1)
 }
+
+// DebugContext logs msg with key-value pairs, plus the request ID, user ID
+// and other attributes added to ctx with WithAttrs
+func DebugContext(ctx context.Context, msg string, args ...any) {
+	logAttrs(ctx, slog.LevelDebug, msg, args...)
+}
+
+// InfoContext is DebugContext at info level
+func InfoContext(ctx context.Context, msg string, args ...any) {
+	logAttrs(ctx, slog.LevelInfo, msg, args...)
+}
+
+// WarnContext is DebugContext at warn level
+func WarnContext(ctx context.Context, msg string, args ...any) {
+	logAttrs(ctx, slog.LevelWarn, msg, args...)
+}
+
+// ErrorContext is DebugContext at error level
+func ErrorContext(ctx context.Context, msg string, args ...any) {
+	logAttrs(ctx, slog.LevelError, msg, args...)
+}
@@ -2,6 +2,8 @@ package logger
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"io"
 	"os"
 	"strings"
@@ -42,28 +44,30 @@ func TestLogger(t *testing.T) {
 		logFunc func(string, ...interface{})
 		message string
 		level   string
-		color   string
 	}{
 		{
 			name:    "Debug Message",
 			logFunc: Debug,
 			message: "test debug message",
 			level:   "DEBUG",
-			color:   colorYellow,
 		},
 		{
 			name:    "Info Message",
 			logFunc: Info,
 			message: "test info message",
 			level:   "INFO",
-			color:   colorGreen,
+		},
+		{
+			name:    "Warn Message",
+			logFunc: Warn,
+			message: "test warn message",
+			level:   "WARN",
 		},
 		{
 			name:    "Error Message",
 			logFunc: Error,
 			message: "test error message",
 			level:   "ERROR",
-			color:   colorRed,
 		},
 	}
 
@@ -106,8 +110,8 @@ func TestLogger(t *testing.T) {
 			if !strings.Contains(output, tt.level) {
 				t.Errorf("Stdout does not contain level: %s", tt.level)
 			}
-			if !strings.Contains(output, tt.color) {
-				t.Errorf("Stdout does not contain color code: %s", tt.color)
+			if strings.Contains(output, "\033[") {
+				t.Error("Stdout contains color codes")
 			}
 
 			// Check file output
@@ -119,6 +123,66 @@ func TestLogger(t *testing.T) {
 			}
 		})
 	}
+
+	// The file is JSON, one record per line
+	for _, line := range strings.Split(strings.TrimSpace(fileOutput), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Log file line is not JSON: %s", line)
+		}
+		if source, _ := record["source"].(string); !strings.HasPrefix(source, "logger_test.go:") {
+			t.Errorf("wrong source: got %q want the calling test file", source)
+		}
+	}
+}
+
+func TestContextAttributes(t *testing.T) {
+	tmpDir := t.TempDir()
+	currentDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	defer os.Chdir(currentDir)
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	Init(false)
+
+	ctx := WithAttrs(context.Background(), "request_id", "req-1")
+	ctx = WithAttrs(ctx, "user_id", "ama")
+	InfoContext(ctx, "object uploaded", "key", "a.png", "bytes", 512)
+	DebugContext(ctx, "not logged below info")
+
+	w.Close()
+	os.Stdout = old
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 record, got %d: %s", len(lines), buf.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("Stdout is not JSON when not a terminal: %s", lines[0])
+	}
+	expected := map[string]interface{}{
+		"level":      "INFO",
+		"msg":        "object uploaded",
+		"request_id": "req-1",
+		"user_id":    "ama",
+		"key":        "a.png",
+		"bytes":      float64(512),
+	}
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("wrong %s: got %v want %v", key, record[key], value)
+		}
+	}
 }
 
 func TestDebugMode(t *testing.T) {
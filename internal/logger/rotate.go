@@ -0,0 +1,291 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLogDir  = "logs"
+	defaultLogName = "server"
+	logFileSuffix  = ".log"
+	compressSuffix = ".gz"
+	dateLayout     = "2006-01-02"
+	// rotated by size within a day, e.g. server_2024-05-01-150405.000.log
+	rotatedTimeLayout = "2006-01-02-150405.000"
+)
+
+type FileConfig struct {
+	Dir        string        `yaml:"dir"`         // "logs" when empty
+	Name       string        `yaml:"name"`        // file names start with it, "server" when empty
+	MaxSizeMB  int           `yaml:"max_size_mb"` // rotate once the file grows past this, 0 only rotates daily
+	MaxBackups int           `yaml:"max_backups"` // rotated files kept, 0 keeps all
+	MaxAge     time.Duration `yaml:"max_age"`     // rotated files older than this are deleted, 0 keeps them
+	Compress   bool          `yaml:"compress"`    // gzip rotated files
+}
+
+// RotatingFile writes to <dir>/<name>_<date>.log, starting a new file every
+// day and whenever the current one reaches MaxSizeMB. Rotated files are
+// compressed and pruned in the background.
+type RotatingFile struct {
+	cfg FileConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	file    *os.File
+	path    string
+	size    int64
+	nextDay time.Time
+
+	millMu sync.Mutex // serialises compression and pruning
+	millCh chan struct{}
+	done   chan struct{}
+}
+
+func NewRotatingFile(config *FileConfig) (*RotatingFile, error) {
+	f := &RotatingFile{
+		now:    time.Now,
+		millCh: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	if config != nil {
+		f.cfg = *config
+	}
+	if f.cfg.Dir == "" {
+		f.cfg.Dir = defaultLogDir
+	}
+	if f.cfg.MaxSizeMB < 0 || f.cfg.MaxBackups < 0 || f.cfg.MaxAge < 0 {
+		return nil, fmt.Errorf("log file limits must not be negative")
+	}
+	if err := os.MkdirAll(f.cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating log directory: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			select {
+			case <-f.millCh:
+				f.mill()
+			case <-f.done:
+				return
+			}
+		}
+	}()
+	// Compress and prune what earlier runs left behind
+	f.triggerMill()
+	return f, nil
+}
+
+// prefix starts the name of every file, current and rotated
+func (f *RotatingFile) prefix() string {
+	if f.cfg.Name == "" {
+		return defaultLogName + "_"
+	}
+	return f.cfg.Name + "_"
+}
+
+// open opens today's file for appending, f.mu must be held
+func (f *RotatingFile) open() error {
+	now := f.now()
+	path := filepath.Join(f.cfg.Dir, f.prefix()+now.Format(dateLayout)+logFileSuffix)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("opening log file: %w", err)
+	}
+
+	f.file = file
+	f.path = path
+	f.size = info.Size()
+	year, month, day := now.Date()
+	f.nextDay = time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	maxSize := int64(f.cfg.MaxSizeMB) << 20
+	if !f.now().Before(f.nextDay) {
+		if err := f.rotate(false); err != nil {
+			return 0, err
+		}
+	} else if maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > maxSize {
+		if err := f.rotate(true); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate closes the current file and opens a new one. Files rotated by size
+// are renamed first so today's name can be reused.
+func (f *RotatingFile) rotate(bySize bool) error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("closing log file: %w", err)
+	}
+	if bySize {
+		rotated := filepath.Join(f.cfg.Dir, f.prefix()+f.now().Format(rotatedTimeLayout)+logFileSuffix)
+		if err := os.Rename(f.path, rotated); err != nil {
+			return fmt.Errorf("rotating log file: %w", err)
+		}
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.triggerMill()
+	return nil
+}
+
+// Rotate starts a new file now, regardless of size and date
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotate(true)
+}
+
+// Reopen closes and reopens the file at its path, for use after an external
+// tool such as logrotate has moved it away
+func (f *RotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil {
+		f.file.Close()
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.triggerMill()
+	return nil
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	close(f.done)
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *RotatingFile) triggerMill() {
+	select {
+	case f.millCh <- struct{}{}:
+	default:
+	}
+}
+
+type backup struct {
+	path    string
+	modTime time.Time
+}
+
+// mill compresses rotated files and removes those beyond MaxBackups or MaxAge
+func (f *RotatingFile) mill() {
+	f.millMu.Lock()
+	defer f.millMu.Unlock()
+
+	f.mu.Lock()
+	active := f.path
+	f.mu.Unlock()
+
+	entries, err := os.ReadDir(f.cfg.Dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logger: reading log directory: %v\n", err)
+		return
+	}
+	var backups []backup
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(f.cfg.Dir, name)
+		if entry.IsDir() || path == active || !strings.HasPrefix(name, f.prefix()) {
+			continue
+		}
+		if !strings.HasSuffix(name, logFileSuffix) && !strings.HasSuffix(name, logFileSuffix+compressSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: path, modTime: info.ModTime()})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].modTime.After(backups[j].modTime) })
+
+	cutoff := time.Time{}
+	if f.cfg.MaxAge > 0 {
+		cutoff = f.now().Add(-f.cfg.MaxAge)
+	}
+	for i, b := range backups {
+		expired := !cutoff.IsZero() && b.modTime.Before(cutoff)
+		if (f.cfg.MaxBackups > 0 && i >= f.cfg.MaxBackups) || expired {
+			if err := os.Remove(b.path); err != nil {
+				fmt.Fprintf(os.Stderr, "logger: removing old log file: %v\n", err)
+			}
+			continue
+		}
+		if f.cfg.Compress && strings.HasSuffix(b.path, logFileSuffix) {
+			if err := compressFile(b.path, b.modTime); err != nil {
+				fmt.Fprintf(os.Stderr, "logger: compressing log file: %v\n", err)
+			}
+		}
+	}
+}
+
+// compressFile replaces path with path.gz, keeping the modification time
+// that retention is based on
+func compressFile(path string, modTime time.Time) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	gzPath := path + compressSuffix
+	dst, err := os.OpenFile(gzPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(gzPath)
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(gzPath)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(gzPath)
+		return err
+	}
+	os.Chtimes(gzPath, modTime, modTime)
+	src.Close()
+	return os.Remove(path)
+}
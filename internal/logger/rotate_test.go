@@ -0,0 +1,159 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestFile returns a rotating file whose clock is set by the returned func
+func newTestFile(t *testing.T, config FileConfig) (*RotatingFile, func(time.Time)) {
+	t.Helper()
+	now := time.Date(2024, 5, 1, 23, 59, 0, 0, time.UTC)
+	config.Dir = t.TempDir()
+	f := &RotatingFile{
+		cfg:    config,
+		now:    func() time.Time { return now },
+		millCh: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	if err := f.open(); err != nil {
+		t.Fatalf("open returned error: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f, func(t time.Time) { now = t }
+}
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read log directory: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRotateByDay(t *testing.T) {
+	f, setNow := newTestFile(t, FileConfig{Compress: true})
+	f.Write([]byte("first day\n"))
+
+	setNow(time.Date(2024, 5, 2, 0, 0, 1, 0, time.UTC))
+	f.Write([]byte("second day\n"))
+	f.mill()
+
+	names := listDir(t, f.cfg.Dir)
+	want := []string{"server_2024-05-01.log.gz", "server_2024-05-02.log"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("wrong files: got %v want %v", names, want)
+	}
+
+	gzFile, err := os.Open(filepath.Join(f.cfg.Dir, want[0]))
+	if err != nil {
+		t.Fatalf("Failed to open compressed file: %v", err)
+	}
+	defer gzFile.Close()
+	reader, err := gzip.NewReader(gzFile)
+	if err != nil {
+		t.Fatalf("Rotated file is not gzip: %v", err)
+	}
+	content, _ := io.ReadAll(reader)
+	if string(content) != "first day\n" {
+		t.Errorf("wrong compressed content: %q", content)
+	}
+}
+
+func TestRotateBySize(t *testing.T) {
+	f, setNow := newTestFile(t, FileConfig{MaxSizeMB: 1})
+	line := []byte(strings.Repeat("a", 600<<10) + "\n")
+
+	f.Write(line)
+	setNow(time.Date(2024, 5, 1, 23, 59, 30, 0, time.UTC))
+	f.Write(line) // would pass 1MB
+
+	names := listDir(t, f.cfg.Dir)
+	want := []string{"server_2024-05-01-235930.000.log", "server_2024-05-01.log"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("wrong files: got %v want %v", names, want)
+	}
+	if f.size != int64(len(line)) {
+		t.Errorf("new file has wrong size: got %v want %v", f.size, len(line))
+	}
+}
+
+func TestRotateNamedFile(t *testing.T) {
+	f, setNow := newTestFile(t, FileConfig{Name: "access", MaxBackups: 1})
+	os.WriteFile(filepath.Join(f.cfg.Dir, "server_2024-04-30.log"), []byte("not ours\n"), 0644)
+	f.Write([]byte("first day\n"))
+
+	setNow(time.Date(2024, 5, 2, 0, 0, 1, 0, time.UTC))
+	f.Write([]byte("second day\n"))
+	setNow(time.Date(2024, 5, 3, 0, 0, 1, 0, time.UTC))
+	f.Write([]byte("third day\n"))
+	f.mill()
+
+	names := listDir(t, f.cfg.Dir)
+	want := []string{"access_2024-05-02.log", "access_2024-05-03.log", "server_2024-04-30.log"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("wrong files: got %v want %v", names, want)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	f, setNow := newTestFile(t, FileConfig{MaxBackups: 2, MaxAge: 48 * time.Hour})
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	setNow(now)
+
+	// Backups from the last five days, newest first
+	for i, name := range []string{
+		"server_2024-05-09.log",
+		"server_2024-05-08.log.gz",
+		"server_2024-05-07.log",
+		"server_2024-05-06.log",
+	} {
+		path := filepath.Join(f.cfg.Dir, name)
+		os.WriteFile(path, []byte("old\n"), 0644)
+		modTime := now.Add(-time.Duration(i+1) * 24 * time.Hour)
+		os.Chtimes(path, modTime, modTime)
+	}
+	os.WriteFile(filepath.Join(f.cfg.Dir, "access.log"), []byte("not ours\n"), 0644)
+	f.mill()
+
+	names := listDir(t, f.cfg.Dir)
+	want := []string{"access.log", "server_2024-05-01.log", "server_2024-05-08.log.gz", "server_2024-05-09.log"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("wrong files kept: got %v want %v", names, want)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	f, _ := newTestFile(t, FileConfig{})
+	f.Write([]byte("before\n"))
+
+	// What logrotate does before sending SIGHUP
+	moved := filepath.Join(f.cfg.Dir, "moved.log")
+	if err := os.Rename(f.path, moved); err != nil {
+		t.Fatalf("Failed to move log file: %v", err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatalf("Reopen returned error: %v", err)
+	}
+	f.Write([]byte("after\n"))
+
+	content, err := os.ReadFile(f.path)
+	if err != nil {
+		t.Fatalf("Reopen did not recreate the log file: %v", err)
+	}
+	if string(content) != "after\n" {
+		t.Errorf("wrong content after reopen: %q", content)
+	}
+}
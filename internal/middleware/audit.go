@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/audit"
+)
+
+// AuditEvent returns an audit event for r with the user authenticated by
+// AuthMiddleware as actor and the client IP and request ID filled in, for
+// the caller to add a target and details before recording it
+func AuditEvent(r *http.Request, action string, outcome string) audit.Event {
+	actor, _ := r.Context().Value(AuthUserID).(string)
+	if actor == "" {
+		actor = audit.Anonymous
+	}
+	return audit.Event{
+		OccurredAt: time.Now(),
+		Actor:      actor,
+		Action:     action,
+		Outcome:    outcome,
+		IP:         ClientIP(r),
+		RequestID:  GetRequestID(r.Context()),
+	}
+}
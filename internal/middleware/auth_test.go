@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/audit"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/auth"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
+)
+
+// tokenFailures returns auth_token_validation_failures_total for reason
+func tokenFailures(t *testing.T, reason string) float64 {
+	families, err := monitoring.Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "auth_token_validation_failures_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if metric.GetLabel()[0].GetValue() == reason {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestAuthMiddlewareMetrics(t *testing.T) {
+	valid, err := auth.GenerateJWT("testuser")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		header         string
+		reason         string
+		expectedStatus int
+	}{
+		{name: "Missing Header", header: "", reason: "missing", expectedStatus: http.StatusUnauthorized},
+		{name: "Basic Scheme", header: "Basic b3BzOnMzY3JldA==", reason: "malformed_header", expectedStatus: http.StatusUnauthorized},
+		{name: "Malformed Token", header: "Bearer not-a-token", reason: "malformed", expectedStatus: http.StatusForbidden},
+		{name: "Valid Token", header: "Bearer " + valid, expectedStatus: http.StatusOK},
+	}
+
+	handler := AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := map[string]float64{}
+			for _, reason := range []string{"missing", "malformed_header", "malformed"} {
+				before[reason] = tokenFailures(t, reason)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+			}
+			for reason, count := range before {
+				expected := count
+				if reason == tt.reason {
+					expected++
+				}
+				if got := tokenFailures(t, reason); got != expected {
+					t.Errorf("wrong %s failures: got %v want %v", reason, got, expected)
+				}
+			}
+		})
+	}
+}
+
+// auditEvents is an audit.Store keeping the events appended to it
+type auditEvents struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (s *auditEvents) Append(ctx context.Context, event audit.Event) (audit.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return event, nil
+}
+
+func (s *auditEvents) List(ctx context.Context, filter audit.Filter) ([]audit.Event, error) {
+	return nil, nil
+}
+
+func (s *auditEvents) ListAfter(ctx context.Context, afterID int64, limit int) ([]audit.Event, error) {
+	return nil, nil
+}
+
+func TestAuthMiddlewareAudit(t *testing.T) {
+	tests := []struct {
+		name           string
+		header         string
+		expectedReason string
+	}{
+		{name: "Missing Header", header: ""},
+		{name: "Basic Scheme", header: "Basic b3BzOnMzY3JldA==", expectedReason: "malformed_header"},
+		{name: "Malformed Token", header: "Bearer not-a-token", expectedReason: "malformed"},
+	}
+
+	handler := AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	defer audit.SetDefault(nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &auditEvents{}
+			log := audit.NewLog(store, nil)
+			audit.SetDefault(log)
+
+			req := httptest.NewRequest(http.MethodGet, "/secure", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if err := log.Close(context.Background()); err != nil {
+				t.Fatalf("Close returned error: %v", err)
+			}
+
+			if tt.expectedReason == "" {
+				if len(store.events) != 0 {
+					t.Errorf("expected no audit events, got %+v", store.events)
+				}
+				return
+			}
+			if len(store.events) != 1 {
+				t.Fatalf("expected 1 audit event, got %d", len(store.events))
+			}
+			event := store.events[0]
+			if event.Action != audit.ActionTokenRejected || event.Details["reason"] != tt.expectedReason {
+				t.Errorf("wrong audit event: got %s %v want %s reason %s", event.Action, event.Details, audit.ActionTokenRejected, tt.expectedReason)
+			}
+		})
+	}
+}
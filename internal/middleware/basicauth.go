@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/utils"
+)
+
+// BasicAuth returns a middleware that requires the given HTTP basic auth
+// credentials, realm is shown by browsers in the login prompt
+func BasicAuth(realm, username, password string) Middleware {
+	// Compare hashes so the comparison takes the same time for any length
+	wantUser := sha256.Sum256([]byte(username))
+	wantPassword := sha256.Sum256([]byte(password))
+	challenge := "Basic realm=" + strconv.Quote(realm) + `, charset="UTF-8"`
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			gotUser := sha256.Sum256([]byte(user))
+			gotPassword := sha256.Sum256([]byte(pass))
+			userMatch := subtle.ConstantTimeCompare(gotUser[:], wantUser[:])
+			passwordMatch := subtle.ConstantTimeCompare(gotPassword[:], wantPassword[:])
+			if !ok || userMatch&passwordMatch != 1 {
+				w.Header().Set("WWW-Authenticate", challenge)
+				utils.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BearerAuth returns a middleware that requires a static bearer token, as
+// sent by Prometheus with bearer_token_file
+func BearerAuth(realm, token string) Middleware {
+	want := sha256.Sum256([]byte(token))
+	challenge := "Bearer realm=" + strconv.Quote(realm)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			gotHash := sha256.Sum256([]byte(got))
+			if !ok || subtle.ConstantTimeCompare(gotHash[:], want[:]) != 1 {
+				w.Header().Set("WWW-Authenticate", challenge)
+				utils.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBasicAuth(t *testing.T) {
+	handler := BasicAuth("debug", "ops", "s3cret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		username       string
+		password       string
+		setAuth        bool
+		expectedStatus int
+	}{
+		{name: "Valid Credentials", username: "ops", password: "s3cret", setAuth: true, expectedStatus: http.StatusOK},
+		{name: "Wrong Password", username: "ops", password: "guess", setAuth: true, expectedStatus: http.StatusUnauthorized},
+		{name: "Wrong User", username: "root", password: "s3cret", setAuth: true, expectedStatus: http.StatusUnauthorized},
+		{name: "No Credentials", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/debug/vars", nil)
+			if tt.setAuth {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			challenge := rr.Header().Get("WWW-Authenticate")
+			if tt.expectedStatus == http.StatusUnauthorized && challenge != `Basic realm="debug", charset="UTF-8"` {
+				t.Errorf("wrong WWW-Authenticate header: %q", challenge)
+			}
+		})
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	handler := BearerAuth("metrics", "t0ken")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		header         string
+		expectedStatus int
+	}{
+		{name: "Valid Token", header: "Bearer t0ken", expectedStatus: http.StatusOK},
+		{name: "Wrong Token", header: "Bearer guess", expectedStatus: http.StatusUnauthorized},
+		{name: "Basic Scheme", header: "Basic b3BzOnMzY3JldA==", expectedStatus: http.StatusUnauthorized},
+		{name: "No Token", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			challenge := rr.Header().Get("WWW-Authenticate")
+			if tt.expectedStatus == http.StatusUnauthorized && challenge != `Bearer realm="metrics"` {
+				t.Errorf("wrong WWW-Authenticate header: %q", challenge)
+			}
+		})
+	}
+}
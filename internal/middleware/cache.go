@@ -0,0 +1,328 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/cache"
+	monitoring "github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
+)
+
+const (
+	CacheStatusHeader        = "X-Cache"
+	defaultCacheMaxEntries   = 1000
+	defaultCacheTTL          = time.Minute
+	defaultCacheMaxBodyBytes = 1 << 20 // 1MB
+)
+
+type ResponseCacheConfig struct {
+	MaxEntries   int           `yaml:"max_entries"`
+	DefaultTTL   time.Duration `yaml:"default_ttl"` // used when neither the route nor the response sets one
+	MaxBodyBytes int64         `yaml:"max_body_bytes"`
+	// VaryHeaders are request headers whose values are part of the cache key,
+	// they are also listed in the Vary response header
+	VaryHeaders []string `yaml:"vary_headers"`
+}
+
+type cachedResponse struct {
+	status   int
+	header   http.Header
+	body     []byte
+	storedAt time.Time
+}
+
+type CacheTagsKey string
+
+const cacheTagsCtx CacheTagsKey = "middleware.cache.tags"
+
+// cacheTags collects the tags a handler adds to the response being cached
+type cacheTags struct {
+	mu   sync.Mutex
+	tags []string
+}
+
+// TagCacheResponse adds invalidation tags to the response of a cached route,
+// e.g. the IDs of the records it lists. It does nothing on other routes.
+func TagCacheResponse(r *http.Request, tags ...string) {
+	if holder, ok := r.Context().Value(cacheTagsCtx).(*cacheTags); ok {
+		holder.mu.Lock()
+		holder.tags = append(holder.tags, tags...)
+		holder.mu.Unlock()
+	}
+}
+
+// ResponseCache is an in-process cache for GET responses. Entries are keyed
+// by URL, the configured vary headers and the authenticated user, so a
+// response is never served to another user.
+type ResponseCache struct {
+	name        string
+	cfg         ResponseCacheConfig
+	entries     *cache.Cache[*cachedResponse]
+	varyHeaders []string
+
+	// Invalidate records the epoch at which each tag was last invalidated,
+	// so a miss that started earlier does not store a response that may be
+	// stale. The record is cleared whenever no miss is in flight.
+	mu            sync.Mutex
+	epoch         uint64
+	invalidatedAt map[string]uint64
+	misses        int
+}
+
+func NewResponseCache(name string, config *ResponseCacheConfig) *ResponseCache {
+	cfg := ResponseCacheConfig{
+		MaxEntries:   defaultCacheMaxEntries,
+		DefaultTTL:   defaultCacheTTL,
+		MaxBodyBytes: defaultCacheMaxBodyBytes,
+	}
+	if config != nil {
+		if config.MaxEntries > 0 {
+			cfg.MaxEntries = config.MaxEntries
+		}
+		if config.DefaultTTL > 0 {
+			cfg.DefaultTTL = config.DefaultTTL
+		}
+		if config.MaxBodyBytes > 0 {
+			cfg.MaxBodyBytes = config.MaxBodyBytes
+		}
+		cfg.VaryHeaders = config.VaryHeaders
+	}
+
+	c := &ResponseCache{
+		name:          name,
+		cfg:           cfg,
+		entries:       cache.New[*cachedResponse](cfg.MaxEntries),
+		invalidatedAt: make(map[string]uint64),
+	}
+	for _, header := range cfg.VaryHeaders {
+		c.varyHeaders = append(c.varyHeaders, http.CanonicalHeaderKey(header))
+	}
+	c.entries.OnEvict(func(string, *cachedResponse) {
+		monitoring.HttpCacheEvictionsTotal.WithLabelValues(name).Inc()
+	})
+	return c
+}
+
+// Invalidate removes every cached response carrying one of the tags
+func (c *ResponseCache) Invalidate(tags ...string) int {
+	c.mu.Lock()
+	c.epoch++
+	if c.misses > 0 {
+		for _, tag := range tags {
+			c.invalidatedAt[tag] = c.epoch
+		}
+	}
+	removed := c.entries.InvalidateTags(tags...)
+	c.mu.Unlock()
+	monitoring.HttpCacheInvalidationsTotal.WithLabelValues(c.name).Add(float64(removed))
+	return removed
+}
+
+// InvalidateAfter returns a middleware that invalidates the tags once the
+// wrapped handler has answered with a 2xx status
+func (c *ResponseCache) InvalidateAfter(tags ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := NewResponseRecorder(w)
+			next.ServeHTTP(recorder, r)
+			if recorder.Status() >= 200 && recorder.Status() < 300 {
+				c.Invalidate(tags...)
+			}
+		})
+	}
+}
+
+// startMiss returns the epoch a miss started at, pass it to endMiss
+func (c *ResponseCache) startMiss() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.misses++
+	return c.epoch
+}
+
+func (c *ResponseCache) endMiss() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.misses--
+	if c.misses == 0 {
+		clear(c.invalidatedAt)
+	}
+}
+
+// store adds a response unless one of its tags was invalidated after the
+// miss that produced it started
+func (c *ResponseCache) store(key string, started uint64, response *cachedResponse, ttl time.Duration, tags []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tag := range tags {
+		if c.invalidatedAt[tag] > started {
+			return
+		}
+	}
+	c.entries.Set(key, response, ttl, tags...)
+}
+
+// key identifies a response by URL, vary header values and user
+func (c *ResponseCache) key(r *http.Request) string {
+	userID, _ := r.Context().Value(AuthUserID).(string)
+	var b strings.Builder
+	b.WriteString(r.URL.RequestURI())
+	b.WriteString("\n")
+	b.WriteString(userID)
+	for _, header := range c.varyHeaders {
+		b.WriteString("\n")
+		b.WriteString(strings.Join(r.Header.Values(header), ","))
+	}
+	return b.String()
+}
+
+// Cache returns a middleware caching successful GET responses for ttl, or the
+// cache's default TTL when ttl is 0. Responses are tagged with tags plus any
+// added through TagCacheResponse.
+//
+// Request "Cache-Control: no-store" bypasses the cache, "no-cache" and
+// "max-age" force or bound revalidation. Responses marked no-store, no-cache
+// or carrying cookies are not stored, "private" ones only for authenticated
+// users, and "s-maxage" or "max-age" override the TTL.
+func (c *ResponseCache) Cache(ttl time.Duration, tags ...string) Middleware {
+	if ttl <= 0 {
+		ttl = c.cfg.DefaultTTL
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			requestCC := parseCacheControl(r.Header.Get("Cache-Control"))
+			if _, ok := requestCC["no-store"]; ok {
+				monitoring.HttpCacheRequestsTotal.WithLabelValues(c.name, "bypass").Inc()
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, header := range c.varyHeaders {
+				w.Header().Add("Vary", header)
+			}
+
+			key := c.key(r)
+			if cached, ok := c.entries.Get(key); ok && freshEnough(requestCC, cached) {
+				monitoring.HttpCacheRequestsTotal.WithLabelValues(c.name, "hit").Inc()
+				serveCachedResponse(w, r, cached)
+				return
+			}
+			monitoring.HttpCacheRequestsTotal.WithLabelValues(c.name, "miss").Inc()
+
+			w.Header().Set(CacheStatusHeader, "MISS")
+			if r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			started := c.startMiss()
+			defer c.endMiss()
+			holder := &cacheTags{}
+			r = r.WithContext(context.WithValue(r.Context(), cacheTagsCtx, holder))
+			headersBefore := w.Header().Clone()
+			recorder := NewResponseRecorder(w)
+			recorder.CaptureBody(c.cfg.MaxBodyBytes)
+			next.ServeHTTP(recorder, r)
+
+			if recorder.Status() != http.StatusOK || recorder.BodyTruncated() || recorder.Hijacked() {
+				return
+			}
+			userID, _ := r.Context().Value(AuthUserID).(string)
+			responseTTL, storable := responseCacheTTL(recorder.Header(), userID != "", ttl)
+			if !storable {
+				return
+			}
+
+			header := replayableHeaders(headersBefore, recorder.Header())
+			header.Del(CacheStatusHeader)
+			holder.mu.Lock()
+			entryTags := append(append([]string(nil), tags...), holder.tags...)
+			holder.mu.Unlock()
+
+			c.store(key, started, &cachedResponse{
+				status:   recorder.Status(),
+				header:   header,
+				body:     recorder.Body(),
+				storedAt: time.Now(),
+			}, responseTTL, entryTags)
+		})
+	}
+}
+
+// freshEnough applies the request's no-cache and max-age directives
+func freshEnough(requestCC map[string]string, cached *cachedResponse) bool {
+	if _, ok := requestCC["no-cache"]; ok {
+		return false
+	}
+	if value, ok := requestCC["max-age"]; ok {
+		maxAge, err := strconv.Atoi(value)
+		if err != nil || time.Since(cached.storedAt) > time.Duration(maxAge)*time.Second {
+			return false
+		}
+	}
+	return true
+}
+
+// responseCacheTTL decides from the response headers whether and for how long to store it
+func responseCacheTTL(header http.Header, authenticated bool, ttl time.Duration) (time.Duration, bool) {
+	if header.Get("Set-Cookie") != "" || header.Get("Vary") == "*" {
+		return 0, false
+	}
+	responseCC := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := responseCC["no-store"]; ok {
+		return 0, false
+	}
+	if _, ok := responseCC["no-cache"]; ok {
+		return 0, false
+	}
+	if _, ok := responseCC["private"]; ok && !authenticated {
+		return 0, false
+	}
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if value, ok := responseCC[directive]; ok {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds <= 0 {
+				return 0, false
+			}
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	return ttl, true
+}
+
+func serveCachedResponse(w http.ResponseWriter, r *http.Request, cached *cachedResponse) {
+	for name, values := range cached.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(cached.storedAt).Seconds())))
+	w.Header().Set(CacheStatusHeader, "HIT")
+	w.WriteHeader(cached.status)
+	if r.Method != http.MethodHead {
+		w.Write(cached.body)
+	}
+}
+
+// parseCacheControl returns the directives of a Cache-Control header with
+// lower case names and unquoted values
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+	}
+	return directives
+}
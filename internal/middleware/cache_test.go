@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseCache(t *testing.T) {
+	type step struct {
+		method         string
+		path           string
+		user           string
+		requestCC      string
+		language       string
+		expectedCache  string
+		expectedBody   string
+		expectedCalled bool
+	}
+
+	tests := []struct {
+		name       string
+		responseCC string
+		steps      []step
+	}{
+		{
+			name: "Miss Then Hit",
+			steps: []step{
+				{method: "GET", path: "/objects", expectedCache: "MISS", expectedBody: "1", expectedCalled: true},
+				{method: "GET", path: "/objects", expectedCache: "HIT", expectedBody: "1"},
+				{method: "HEAD", path: "/objects", expectedCache: "HIT"},
+			},
+		},
+		{
+			name: "Query Is Part Of The Key",
+			steps: []step{
+				{method: "GET", path: "/objects?page=1", expectedCache: "MISS", expectedBody: "1", expectedCalled: true},
+				{method: "GET", path: "/objects?page=2", expectedCache: "MISS", expectedBody: "2", expectedCalled: true},
+			},
+		},
+		{
+			name: "Users Do Not Share Entries",
+			steps: []step{
+				{method: "GET", path: "/objects", user: "ama", expectedCache: "MISS", expectedBody: "1", expectedCalled: true},
+				{method: "GET", path: "/objects", user: "kofi", expectedCache: "MISS", expectedBody: "2", expectedCalled: true},
+				{method: "GET", path: "/objects", user: "ama", expectedCache: "HIT", expectedBody: "1"},
+			},
+		},
+		{
+			name: "Vary Header Is Part Of The Key",
+			steps: []step{
+				{method: "GET", path: "/objects", language: "en", expectedCache: "MISS", expectedBody: "1", expectedCalled: true},
+				{method: "GET", path: "/objects", language: "fr", expectedCache: "MISS", expectedBody: "2", expectedCalled: true},
+			},
+		},
+		{
+			name: "Request No-Cache Revalidates",
+			steps: []step{
+				{method: "GET", path: "/objects", expectedCache: "MISS", expectedBody: "1", expectedCalled: true},
+				{method: "GET", path: "/objects", requestCC: "no-cache", expectedCache: "MISS", expectedBody: "2", expectedCalled: true},
+				{method: "GET", path: "/objects", expectedCache: "HIT", expectedBody: "2"},
+			},
+		},
+		{
+			name: "Request No-Store Bypasses",
+			steps: []step{
+				{method: "GET", path: "/objects", requestCC: "no-store", expectedBody: "1", expectedCalled: true},
+				{method: "GET", path: "/objects", expectedCache: "MISS", expectedBody: "2", expectedCalled: true},
+			},
+		},
+		{
+			name:       "Response No-Store Is Not Cached",
+			responseCC: "no-store",
+			steps: []step{
+				{method: "GET", path: "/objects", expectedCache: "MISS", expectedBody: "1", expectedCalled: true},
+				{method: "GET", path: "/objects", expectedCache: "MISS", expectedBody: "2", expectedCalled: true},
+			},
+		},
+		{
+			name:       "Private Response Without User Is Not Cached",
+			responseCC: "private, max-age=60",
+			steps: []step{
+				{method: "GET", path: "/objects", expectedCache: "MISS", expectedBody: "1", expectedCalled: true},
+				{method: "GET", path: "/objects", expectedCache: "MISS", expectedBody: "2", expectedCalled: true},
+			},
+		},
+		{
+			name:       "Private Response With User Is Cached",
+			responseCC: "private, max-age=60",
+			steps: []step{
+				{method: "GET", path: "/objects", user: "ama", expectedCache: "MISS", expectedBody: "1", expectedCalled: true},
+				{method: "GET", path: "/objects", user: "ama", expectedCache: "HIT", expectedBody: "1"},
+			},
+		},
+		{
+			name: "Other Methods Pass Through",
+			steps: []step{
+				{method: "POST", path: "/objects", expectedBody: "1", expectedCalled: true},
+				{method: "POST", path: "/objects", expectedBody: "2", expectedCalled: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := NewResponseCache("test", &ResponseCacheConfig{VaryHeaders: []string{"Accept-Language"}})
+			calls := 0
+			handler := rc.Cache(0, "objects")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if tt.responseCC != "" {
+					w.Header().Set("Cache-Control", tt.responseCC)
+				}
+				fmt.Fprintf(w, "%d", calls)
+			}))
+
+			for i, s := range tt.steps {
+				before := calls
+				req := httptest.NewRequest(s.method, s.path, nil)
+				if s.user != "" {
+					req = req.WithContext(context.WithValue(req.Context(), AuthUserID, s.user))
+				}
+				if s.requestCC != "" {
+					req.Header.Set("Cache-Control", s.requestCC)
+				}
+				if s.language != "" {
+					req.Header.Set("Accept-Language", s.language)
+				}
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+
+				if got := rr.Header().Get(CacheStatusHeader); got != s.expectedCache {
+					t.Errorf("step %d: wrong %s header: got %q want %q", i, CacheStatusHeader, got, s.expectedCache)
+				}
+				if s.method != "HEAD" && rr.Body.String() != s.expectedBody {
+					t.Errorf("step %d: wrong body: got %q want %q", i, rr.Body.String(), s.expectedBody)
+				}
+				if called := calls > before; called != s.expectedCalled {
+					t.Errorf("step %d: handler called %t, want %t", i, called, s.expectedCalled)
+				}
+			}
+		})
+	}
+}
+
+func TestResponseCacheInvalidation(t *testing.T) {
+	rc := NewResponseCache("test", nil)
+	calls := 0
+	list := rc.Cache(0, "objects")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		TagCacheResponse(r, "object:"+r.URL.Query().Get("id"))
+		fmt.Fprintf(w, "%d", calls)
+	}))
+	upload := rc.InvalidateAfter("objects")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	failedUpload := rc.InvalidateAfter("objects")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	get := func(path string) string {
+		rr := httptest.NewRecorder()
+		list.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr.Header().Get(CacheStatusHeader)
+	}
+
+	get("/objects?id=1")
+	get("/objects?id=2")
+
+	failedUpload.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/upload", nil))
+	if got := get("/objects?id=1"); got != "HIT" {
+		t.Errorf("failed request invalidated the cache, got %s", got)
+	}
+
+	if removed := rc.Invalidate("object:2"); removed != 1 {
+		t.Errorf("wrong number of entries invalidated by handler tag: got %d want 1", removed)
+	}
+	if got := get("/objects?id=2"); got != "MISS" {
+		t.Errorf("expected MISS after tag invalidation, got %s", got)
+	}
+
+	upload.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/upload", nil))
+	if got := get("/objects?id=1"); got != "MISS" {
+		t.Errorf("expected MISS after successful upload, got %s", got)
+	}
+}
+
+func TestResponseCacheInvalidationDuringMiss(t *testing.T) {
+	rc := NewResponseCache("test", nil)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	calls := 0
+	list := rc.Cache(0, "objects")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			close(started)
+			<-release
+		}
+		fmt.Fprintf(w, "%d", calls)
+	}))
+	upload := rc.InvalidateAfter("objects")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		list.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/objects", nil))
+	}()
+
+	// The upload lands while the first listing is still being built
+	<-started
+	upload.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/upload", nil))
+	close(release)
+	<-done
+
+	rr := httptest.NewRecorder()
+	list.ServeHTTP(rr, httptest.NewRequest("GET", "/objects", nil))
+	if got := rr.Header().Get(CacheStatusHeader); got != "MISS" {
+		t.Errorf("response started before the invalidation was stored, got %s", got)
+	}
+	if body := rr.Body.String(); body != "2" {
+		t.Errorf("handler returned unexpected body: got %v want %v", body, "2")
+	}
+
+	rr = httptest.NewRecorder()
+	list.ServeHTTP(rr, httptest.NewRequest("GET", "/objects", nil))
+	if got := rr.Header().Get(CacheStatusHeader); got != "HIT" {
+		t.Errorf("expected HIT once no invalidation overlaps the miss, got %s", got)
+	}
+	if len(rc.invalidatedAt) != 0 {
+		t.Errorf("invalidation record kept %d tags with no miss in flight", len(rc.invalidatedAt))
+	}
+}
@@ -1,36 +1,65 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
 	"strings"
-	"sync"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/utils"
 )
 
+// CorsConfig describes a single CORS policy.
+//
+// AllowedOrigins entries may be:
+//   - "*" to allow any origin (not allowed together with Credentials)
+//   - an exact origin such as "https://example.com"
+//   - a wildcard subdomain such as "https://*.example.com"
+//   - a regular expression prefixed with "regex:", e.g. "regex:https://app-[0-9]+\.example\.com",
+//     which must match the whole origin
 type CorsConfig struct {
-	AllowedOrigins []string
-	AllowedMethods []string
-	AllowedHeaders []string
-	MaxAge         string // Optional
-	Credentials    bool   // Optional, for Access-Control-Allow-Credentials
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	AllowedMethods []string `yaml:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers"`
+	ExposedHeaders []string `yaml:"exposed_headers"`
+	MaxAge         string   `yaml:"max_age"`     // Optional
+	Credentials    bool     `yaml:"credentials"` // Optional, for Access-Control-Allow-Credentials
 }
 
-var (
-	corsConfig *CorsConfig
-	corsOnce   sync.Once
+// CorsGroupPolicy applies a CorsConfig to every request path under Prefix
+type CorsGroupPolicy struct {
+	Prefix     string `yaml:"prefix"`
+	CorsConfig `yaml:",inline"`
+}
+
+// CorsPolicies is the CORS section of config.yaml: a default policy plus
+// optional per-route-group overrides. The longest matching prefix wins.
+type CorsPolicies struct {
+	Default CorsConfig        `yaml:"default"`
+	Groups  []CorsGroupPolicy `yaml:"groups"`
+}
+
+const regexOriginPrefix = "regex:"
 
+var (
 	DefaultCorsConfig = &CorsConfig{
 		AllowedOrigins: []string{"*"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{"Content-Type", "Authorization"},
 	}
+
+	defaultCorsPolicy = mustCompileCors(DefaultCorsConfig)
 )
 
 // validateAndSetDefaults ensures all required fields have values
 func validateAndSetDefaults(config *CorsConfig) *CorsConfig {
 	// Create new config to avoid modifying the input
 	validConfig := &CorsConfig{
-		Credentials: config.Credentials, // Keep original credentials setting
-		MaxAge:      config.MaxAge,      // Keep original max age setting
+		Credentials:    config.Credentials,    // Keep original credentials setting
+		MaxAge:         config.MaxAge,         // Keep original max age setting
+		ExposedHeaders: config.ExposedHeaders, // Exposed headers have no default
 	}
 
 	// Validate and set Origins
@@ -45,15 +74,12 @@ func validateAndSetDefaults(config *CorsConfig) *CorsConfig {
 		validConfig.AllowedMethods = DefaultCorsConfig.AllowedMethods
 	} else {
 		// Ensure OPTIONS is included if not present
-		hasOptions := false
-		for _, method := range config.AllowedMethods {
-			if method == "OPTIONS" {
-				hasOptions = true
-				break
-			}
-		}
+		hasOptions := slices.ContainsFunc(config.AllowedMethods, func(method string) bool {
+			return strings.EqualFold(method, http.MethodOptions)
+		})
 		if !hasOptions {
-			validConfig.AllowedMethods = append(config.AllowedMethods, "OPTIONS")
+			// Clip so the append never writes into the caller's slice
+			validConfig.AllowedMethods = append(slices.Clip(config.AllowedMethods), http.MethodOptions)
 		} else {
 			validConfig.AllowedMethods = config.AllowedMethods
 		}
@@ -69,66 +95,269 @@ func validateAndSetDefaults(config *CorsConfig) *CorsConfig {
 	return validConfig
 }
 
-// SetCorsConfig sets the global CORS configuration with validation
-func SetCorsConfig(config *CorsConfig) error {
+// wildcardOrigin matches "scheme://*.domain" style origins
+type wildcardOrigin struct {
+	scheme string
+	suffix string
+}
+
+type corsPolicy struct {
+	config         *CorsConfig
+	allowAnyOrigin bool
+	allowAnyHeader bool
+	origins        map[string]bool
+	wildcards      []wildcardOrigin
+	patterns       []*regexp.Regexp
+	methods        map[string]bool
+	headers        map[string]bool
+	allowedMethods string
+	allowedHeaders string
+	exposedHeaders string
+}
+
+// compileCors validates a CorsConfig and prepares it for matching
+func compileCors(config *CorsConfig) (*corsPolicy, error) {
 	if config == nil {
-		corsConfig = DefaultCorsConfig
-		return nil
+		config = DefaultCorsConfig
 	}
+	config = validateAndSetDefaults(config)
 
-	corsOnce.Do(func() {
-		corsConfig = validateAndSetDefaults(config)
-	})
-	return nil
+	policy := &corsPolicy{
+		config:         config,
+		origins:        make(map[string]bool),
+		methods:        make(map[string]bool),
+		headers:        make(map[string]bool),
+		allowedMethods: strings.Join(config.AllowedMethods, ", "),
+		allowedHeaders: strings.Join(config.AllowedHeaders, ", "),
+		exposedHeaders: strings.Join(config.ExposedHeaders, ", "),
+	}
+
+	for _, origin := range config.AllowedOrigins {
+		switch {
+		case origin == "*":
+			policy.allowAnyOrigin = true
+		case strings.HasPrefix(origin, regexOriginPrefix):
+			// Anchored so a pattern cannot match part of a longer origin
+			re, err := regexp.Compile("^(?:" + strings.TrimPrefix(origin, regexOriginPrefix) + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid CORS origin pattern %q: %w", origin, err)
+			}
+			policy.patterns = append(policy.patterns, re)
+		case strings.Contains(origin, "://*."):
+			scheme, host, _ := strings.Cut(origin, "://")
+			policy.wildcards = append(policy.wildcards, wildcardOrigin{
+				scheme: strings.ToLower(scheme),
+				suffix: strings.ToLower(strings.TrimPrefix(host, "*")),
+			})
+		case strings.Contains(origin, "*"):
+			return nil, fmt.Errorf("invalid CORS origin %q: wildcards are only supported as a leading subdomain", origin)
+		default:
+			policy.origins[strings.ToLower(origin)] = true
+		}
+	}
+
+	for _, method := range config.AllowedMethods {
+		policy.methods[strings.ToUpper(method)] = true
+	}
+	for _, header := range config.AllowedHeaders {
+		if header == "*" {
+			policy.allowAnyHeader = true
+			continue
+		}
+		policy.headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	if config.Credentials && (policy.allowAnyOrigin || policy.allowAnyHeader) {
+		return nil, fmt.Errorf("CORS policy cannot combine \"*\" with credentials")
+	}
+
+	return policy, nil
 }
 
-// GetCorsConfig returns the current CORS configuration
-func GetCorsConfig() *CorsConfig {
-	if corsConfig == nil {
-		corsConfig = DefaultCorsConfig
+func mustCompileCors(config *CorsConfig) *corsPolicy {
+	policy, err := compileCors(config)
+	if err != nil {
+		panic(err)
 	}
-	return corsConfig
+	return policy
 }
 
-// CorsWrapper wraps an http.Handler with CORS headers.
-func CorsWrapper(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		config := GetCorsConfig()
-		origin := r.Header.Get("Origin")
-
-		if len(config.AllowedOrigins) == 1 && config.AllowedOrigins[0] == "*" {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-		} else if origin != "" {
-			for _, allowedOrigin := range config.AllowedOrigins {
-				if allowedOrigin == origin {
-					w.Header().Set("Access-Control-Allow-Origin", origin)
-					break
+// originAllowed reports whether the request origin matches the policy
+func (p *corsPolicy) originAllowed(origin string) bool {
+	if p.allowAnyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	if len(p.wildcards) > 0 {
+		if u, err := url.Parse(origin); err == nil && u.Host != "" {
+			for _, w := range p.wildcards {
+				if u.Scheme == w.scheme && strings.HasSuffix(u.Host, w.suffix) && len(u.Host) > len(w.suffix) {
+					return true
 				}
 			}
 		}
+	}
+	for _, re := range p.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// headersAllowed reports whether every header listed in Access-Control-Request-Headers is allowed
+func (p *corsPolicy) headersAllowed(requested []string) bool {
+	if p.allowAnyHeader {
+		return true
+	}
+	for _, header := range requested {
+		if !p.headers[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
+
+func parseHeaderList(value string) []string {
+	var headers []string
+	for _, header := range strings.Split(value, ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			headers = append(headers, header)
+		}
+	}
+	return headers
+}
 
-		// Handle methods
-		w.Header().Set("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
+func (p *corsPolicy) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	header := w.Header()
+	origin := r.Header.Get("Origin")
+	preflight := r.Method == http.MethodOptions && origin != "" && r.Header.Get("Access-Control-Request-Method") != ""
 
-		// Handle headers
-		w.Header().Set("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
+	// Responses differ per origin unless every origin gets "*"
+	if !p.allowAnyOrigin {
+		header.Add("Vary", "Origin")
+	}
+	if preflight {
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+	}
 
-		// Handle credentials if set
-		if config.Credentials {
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
+	if origin == "" {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	if !p.originAllowed(origin) {
+		if preflight {
+			utils.RespondWithError(w, http.StatusForbidden, "CORS origin not allowed")
+			return
 		}
+		// Serve without CORS headers and let the browser block the response
+		next.ServeHTTP(w, r)
+		return
+	}
 
-		// Handle max age if set
-		if config.MaxAge != "" {
-			w.Header().Set("Access-Control-Max-Age", config.MaxAge)
+	if p.allowAnyOrigin {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	// Handle credentials if set
+	if p.config.Credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !preflight {
+		if p.exposedHeaders != "" {
+			header.Set("Access-Control-Expose-Headers", p.exposedHeaders)
 		}
+		next.ServeHTTP(w, r)
+		return
+	}
 
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+	// Handle preflight requests
+	if !p.methods[strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))] {
+		utils.RespondWithError(w, http.StatusForbidden, "CORS method not allowed")
+		return
+	}
+	requestedHeaders := parseHeaderList(r.Header.Get("Access-Control-Request-Headers"))
+	if !p.headersAllowed(requestedHeaders) {
+		utils.RespondWithError(w, http.StatusForbidden, "CORS headers not allowed")
+		return
+	}
+
+	header.Set("Access-Control-Allow-Methods", p.allowedMethods)
+	if p.allowAnyHeader && len(requestedHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(requestedHeaders, ", "))
+	} else {
+		header.Set("Access-Control-Allow-Headers", p.allowedHeaders)
+	}
+
+	// Handle max age if set
+	if p.config.MaxAge != "" {
+		header.Set("Access-Control-Max-Age", p.config.MaxAge)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NewCors returns a middleware applying a single CORS policy
+func NewCors(config *CorsConfig) (Middleware, error) {
+	policy, err := compileCors(config)
+	if err != nil {
+		return nil, err
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			policy.serve(w, r, next)
+		})
+	}, nil
+}
+
+// NewCorsPolicies returns a middleware that selects the policy of the
+// longest matching route group prefix, falling back to the default policy.
+func NewCorsPolicies(policies CorsPolicies) (Middleware, error) {
+	defaultPolicy, err := compileCors(&policies.Default)
+	if err != nil {
+		return nil, fmt.Errorf("default CORS policy: %w", err)
+	}
+
+	type groupPolicy struct {
+		prefix string
+		policy *corsPolicy
+	}
+	groups := make([]groupPolicy, 0, len(policies.Groups))
+	for _, group := range policies.Groups {
+		if group.Prefix == "" {
+			return nil, fmt.Errorf("CORS group policy is missing a prefix")
+		}
+		policy, err := compileCors(&group.CorsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("CORS policy for %s: %w", group.Prefix, err)
 		}
-		// Call the next handler, which can be another middleware in the chain, or the final handler.
-		h.ServeHTTP(w, r)
+		groups = append(groups, groupPolicy{prefix: group.Prefix, policy: policy})
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			policy, matched := defaultPolicy, ""
+			for _, group := range groups {
+				if strings.HasPrefix(r.URL.Path, group.prefix) && len(group.prefix) > len(matched) {
+					policy, matched = group.policy, group.prefix
+				}
+			}
+			policy.serve(w, r, next)
+		})
+	}, nil
+}
+
+// CorsWrapper wraps an http.Handler with the default CORS policy.
+func CorsWrapper(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defaultCorsPolicy.serve(w, r, h)
 	})
 }
@@ -4,16 +4,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
-	"sync"
 	"testing"
 )
 
-// Reset CORS config before each test
-func resetCorsConfig() {
-	corsConfig = nil
-	corsOnce = sync.Once{}
-}
-
 func TestCorsWrapper(t *testing.T) {
 	tests := []struct {
 		name            string
@@ -25,7 +18,7 @@ func TestCorsWrapper(t *testing.T) {
 		expectedHeaders map[string]string
 	}{
 		{
-			name: "Custom Global Config",
+			name: "Custom Config Preflight",
 			setupConfig: &CorsConfig{
 				AllowedOrigins: []string{"http://example.com"},
 				AllowedMethods: []string{"GET", "POST", "OPTIONS"},
@@ -33,9 +26,13 @@ func TestCorsWrapper(t *testing.T) {
 				Credentials:    true,
 				MaxAge:         "3600",
 			},
-			requestMethod:  "OPTIONS",
-			requestOrigin:  "http://example.com",
-			expectedStatus: http.StatusOK,
+			requestMethod: "OPTIONS",
+			requestOrigin: "http://example.com",
+			requestHeaders: map[string]string{
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "x-custom-header",
+			},
+			expectedStatus: http.StatusNoContent,
 			expectedHeaders: map[string]string{
 				"Access-Control-Allow-Origin":      "http://example.com",
 				"Access-Control-Allow-Methods":     "GET, POST, OPTIONS",
@@ -44,6 +41,78 @@ func TestCorsWrapper(t *testing.T) {
 				"Access-Control-Max-Age":           "3600",
 			},
 		},
+		{
+			name: "Preflight Disallowed Method",
+			setupConfig: &CorsConfig{
+				AllowedOrigins: []string{"http://example.com"},
+				AllowedMethods: []string{"GET"},
+			},
+			requestMethod: "OPTIONS",
+			requestOrigin: "http://example.com",
+			requestHeaders: map[string]string{
+				"Access-Control-Request-Method": "DELETE",
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Methods": "",
+			},
+		},
+		{
+			name: "Preflight Disallowed Header",
+			setupConfig: &CorsConfig{
+				AllowedOrigins: []string{"http://example.com"},
+			},
+			requestMethod: "OPTIONS",
+			requestOrigin: "http://example.com",
+			requestHeaders: map[string]string{
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "Content-Type, X-Secret",
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "Preflight Disallowed Origin",
+			setupConfig: &CorsConfig{
+				AllowedOrigins: []string{"http://example.com"},
+			},
+			requestMethod: "OPTIONS",
+			requestOrigin: "http://evil.com",
+			requestHeaders: map[string]string{
+				"Access-Control-Request-Method": "GET",
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name: "Plain OPTIONS Is Not A Preflight",
+			setupConfig: &CorsConfig{
+				AllowedOrigins: []string{"http://example.com"},
+			},
+			requestMethod:  "OPTIONS",
+			requestOrigin:  "http://example.com",
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "http://example.com",
+				"Access-Control-Allow-Methods": "",
+			},
+		},
+		{
+			name: "Exposed Headers On Actual Request",
+			setupConfig: &CorsConfig{
+				AllowedOrigins: []string{"http://example.com"},
+				ExposedHeaders: []string{"X-Request-ID", "Content-Length"},
+			},
+			requestMethod:  "GET",
+			requestOrigin:  "http://example.com",
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin":   "http://example.com",
+				"Access-Control-Expose-Headers": "X-Request-ID, Content-Length",
+				"Vary":                          "Origin",
+			},
+		},
 		{
 			name:           "Fallback Default Config",
 			setupConfig:    nil, // Don't set config, let it use default
@@ -51,23 +120,14 @@ func TestCorsWrapper(t *testing.T) {
 			requestOrigin:  "http://example.com",
 			expectedStatus: http.StatusOK,
 			expectedHeaders: map[string]string{
-				"Access-Control-Allow-Origin":  "*",
-				"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE, OPTIONS",
-				"Access-Control-Allow-Headers": "Content-Type, Authorization",
+				"Access-Control-Allow-Origin": "*",
+				"Vary":                        "",
 			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Reset config before each test
-			resetCorsConfig()
-
-			// Set config if provided
-			if tt.setupConfig != nil {
-				SetCorsConfig(tt.setupConfig)
-			}
-
 			// Create test handler
 			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusOK)
@@ -88,7 +148,16 @@ func TestCorsWrapper(t *testing.T) {
 			rr := httptest.NewRecorder()
 
 			// Create middleware handler
-			corsHandler := CorsWrapper(handler)
+			var corsHandler http.Handler
+			if tt.setupConfig != nil {
+				cors, err := NewCors(tt.setupConfig)
+				if err != nil {
+					t.Fatalf("NewCors returned error: %v", err)
+				}
+				corsHandler = cors(handler)
+			} else {
+				corsHandler = CorsWrapper(handler)
+			}
 
 			// Serve request
 			corsHandler.ServeHTTP(rr, req)
@@ -110,6 +179,165 @@ func TestCorsWrapper(t *testing.T) {
 	}
 }
 
+func TestCorsOriginPatterns(t *testing.T) {
+	policy, err := compileCors(&CorsConfig{
+		AllowedOrigins: []string{
+			"https://example.com",
+			"https://*.example.org",
+			`regex:^https://app-[0-9]+\.example\.net$`,
+			`regex:https://admin\.example\.io`,
+		},
+	})
+	if err != nil {
+		t.Fatalf("compileCors returned error: %v", err)
+	}
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{origin: "https://example.com", allowed: true},
+		{origin: "https://EXAMPLE.com", allowed: true},
+		{origin: "http://example.com", allowed: false},
+		{origin: "https://api.example.org", allowed: true},
+		{origin: "https://a.b.example.org", allowed: true},
+		{origin: "https://example.org", allowed: false},
+		{origin: "http://api.example.org", allowed: false},
+		{origin: "https://evilexample.org", allowed: false},
+		{origin: "https://app-12.example.net", allowed: true},
+		{origin: "https://app-x.example.net", allowed: false},
+		{origin: "https://admin.example.io", allowed: true},
+		{origin: "https://admin.example.io.evil.com", allowed: false},
+		{origin: "https://evil.com/https://admin.example.io", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			if got := policy.originAllowed(tt.origin); got != tt.allowed {
+				t.Errorf("originAllowed(%s) = %v, want %v", tt.origin, got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestCorsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *CorsConfig
+	}{
+		{
+			name: "Wildcard Origin With Credentials",
+			config: &CorsConfig{
+				AllowedOrigins: []string{"*"},
+				Credentials:    true,
+			},
+		},
+		{
+			name: "Wildcard Header With Credentials",
+			config: &CorsConfig{
+				AllowedOrigins: []string{"http://example.com"},
+				AllowedHeaders: []string{"*"},
+				Credentials:    true,
+			},
+		},
+		{
+			name: "Invalid Regex",
+			config: &CorsConfig{
+				AllowedOrigins: []string{"regex:^https://(.example.com$"},
+			},
+		},
+		{
+			name: "Wildcard In Middle Of Host",
+			config: &CorsConfig{
+				AllowedOrigins: []string{"https://api.*.example.com"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewCors(tt.config); err == nil {
+				t.Error("Expected error but got none")
+			}
+		})
+	}
+}
+
+func TestCorsPolicies(t *testing.T) {
+	cors, err := NewCorsPolicies(CorsPolicies{
+		Default: CorsConfig{
+			AllowedOrigins: []string{"http://example.com"},
+		},
+		Groups: []CorsGroupPolicy{
+			{
+				Prefix: "/api/v1/auth/",
+				CorsConfig: CorsConfig{
+					AllowedOrigins: []string{"http://login.example.com"},
+					Credentials:    true,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewCorsPolicies returned error: %v", err)
+	}
+
+	handler := cors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name                string
+		path                string
+		origin              string
+		expectedOrigin      string
+		expectedCredentials string
+	}{
+		{
+			name:           "Default Policy",
+			path:           "/api/v1/healthz",
+			origin:         "http://example.com",
+			expectedOrigin: "http://example.com",
+		},
+		{
+			name:           "Default Policy Rejects Group Origin",
+			path:           "/api/v1/healthz",
+			origin:         "http://login.example.com",
+			expectedOrigin: "",
+		},
+		{
+			name:                "Group Policy",
+			path:                "/api/v1/auth/signIn",
+			origin:              "http://login.example.com",
+			expectedOrigin:      "http://login.example.com",
+			expectedCredentials: "true",
+		},
+		{
+			name:           "Group Policy Rejects Default Origin",
+			path:           "/api/v1/auth/signIn",
+			origin:         "http://example.com",
+			expectedOrigin: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Origin", tt.origin)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedOrigin {
+				t.Errorf("wrong Access-Control-Allow-Origin: got %v want %v", got, tt.expectedOrigin)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != tt.expectedCredentials {
+				t.Errorf("wrong Access-Control-Allow-Credentials: got %v want %v", got, tt.expectedCredentials)
+			}
+		})
+	}
+}
+
 func TestValidateAndSetDefaults(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -158,6 +386,17 @@ func TestValidateAndSetDefaults(t *testing.T) {
 				AllowedHeaders: DefaultCorsConfig.AllowedHeaders,
 			},
 		},
+		{
+			name: "Methods With Lowercase OPTIONS",
+			inputConfig: &CorsConfig{
+				AllowedMethods: []string{"GET", "options"},
+			},
+			expectedConfig: &CorsConfig{
+				AllowedOrigins: DefaultCorsConfig.AllowedOrigins,
+				AllowedMethods: []string{"GET", "options"},
+				AllowedHeaders: DefaultCorsConfig.AllowedHeaders,
+			},
+		},
 		{
 			name: "Custom Headers Only",
 			inputConfig: &CorsConfig{
@@ -238,32 +477,3 @@ func TestValidateAndSetDefaults(t *testing.T) {
 		})
 	}
 }
-
-func TestSetCorsConfig(t *testing.T) {
-	resetCorsConfig()
-
-	config1 := &CorsConfig{
-		AllowedOrigins: []string{"http://first.com"},
-	}
-
-	config2 := &CorsConfig{
-		AllowedOrigins: []string{"http://second.com"},
-	}
-
-	// Set first config
-	SetCorsConfig(config1)
-	firstConfig := GetCorsConfig()
-
-	// Try to set second config
-	SetCorsConfig(config2)
-	secondConfig := GetCorsConfig()
-
-	// Verify that the second set didn't change the config (due to sync.Once)
-	if firstConfig.AllowedOrigins[0] != secondConfig.AllowedOrigins[0] {
-		t.Error("CORS config was modified after initial set")
-	}
-
-	if secondConfig.AllowedOrigins[0] != "http://first.com" {
-		t.Error("CORS config doesn't match first set configuration")
-	}
-}
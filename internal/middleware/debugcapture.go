@@ -0,0 +1,315 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/auth"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/logger"
+)
+
+const (
+	// DebugCaptureHeader asks for the request to be captured, it is only
+	// honoured for requests carrying an admin token
+	DebugCaptureHeader = "X-Debug-Capture"
+
+	redactedValue              = "[REDACTED]"
+	defaultCaptureMaxBodyBytes = 64 << 10 // 64KB
+	defaultCaptureBufferSize   = 100
+)
+
+var defaultRedactHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+type BodyCaptureConfig struct {
+	MaxBodyBytes int64 `yaml:"max_body_bytes"` // per body, the rest is dropped
+	// RedactFields are JSON, form and query field names, matched
+	// case-insensitively at any depth, whose values are replaced before a
+	// capture is stored
+	RedactFields  []string `yaml:"redact_fields"`
+	RedactHeaders []string `yaml:"redact_headers"` // added to Authorization, Cookie and Set-Cookie
+	BufferSize    int      `yaml:"buffer_size"`    // captures kept for the admin endpoint
+	Log           bool     `yaml:"log"`            // also write captures to the application log
+	// Routes are path prefixes captured for every request
+	Routes []string `yaml:"routes"`
+}
+
+// Capture is a recorded request and response with sensitive values redacted
+type Capture struct {
+	Time                  time.Time           `json:"time"`
+	RequestID             string              `json:"request_id,omitempty"`
+	UserID                string              `json:"user_id,omitempty"`
+	Method                string              `json:"method"`
+	Path                  string              `json:"path"`
+	Status                int                 `json:"status"`
+	DurationMs            float64             `json:"duration_ms"`
+	RequestHeaders        map[string][]string `json:"request_headers"`
+	RequestBody           string              `json:"request_body,omitempty"`
+	RequestBodyTruncated  bool                `json:"request_body_truncated,omitempty"`
+	ResponseHeaders       map[string][]string `json:"response_headers"`
+	ResponseBody          string              `json:"response_body,omitempty"`
+	ResponseBodyTruncated bool                `json:"response_body_truncated,omitempty"`
+}
+
+// BodyCapture records request and response bodies of selected requests into
+// a ring buffer, for debugging what a client actually sent and received
+type BodyCapture struct {
+	cfg           BodyCaptureConfig
+	redactFields  map[string]bool
+	redactHeaders map[string]bool
+
+	mu       sync.Mutex
+	captures []Capture // ring buffer, next is the slot written next
+	next     int
+	full     bool
+}
+
+func NewBodyCapture(config *BodyCaptureConfig) *BodyCapture {
+	cfg := BodyCaptureConfig{
+		MaxBodyBytes: defaultCaptureMaxBodyBytes,
+		BufferSize:   defaultCaptureBufferSize,
+	}
+	if config != nil {
+		if config.MaxBodyBytes > 0 {
+			cfg.MaxBodyBytes = config.MaxBodyBytes
+		}
+		if config.BufferSize > 0 {
+			cfg.BufferSize = config.BufferSize
+		}
+		cfg.RedactFields = config.RedactFields
+		cfg.RedactHeaders = config.RedactHeaders
+		cfg.Log = config.Log
+		cfg.Routes = config.Routes
+	}
+
+	c := &BodyCapture{
+		cfg:           cfg,
+		redactFields:  make(map[string]bool),
+		redactHeaders: make(map[string]bool),
+		captures:      make([]Capture, cfg.BufferSize),
+	}
+	for _, field := range cfg.RedactFields {
+		c.redactFields[strings.ToLower(field)] = true
+	}
+	for _, header := range append(defaultRedactHeaders, cfg.RedactHeaders...) {
+		c.redactHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+	return c
+}
+
+// Captures returns the stored captures, newest first. A non-empty requestID
+// only returns the captures of that request, limit 0 returns all.
+func (c *BodyCapture) Captures(requestID string, limit int) []Capture {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count := c.next
+	if c.full {
+		count = len(c.captures)
+	}
+	result := []Capture{}
+	for i := 1; i <= count; i++ {
+		capture := c.captures[(c.next-i+len(c.captures))%len(c.captures)]
+		if requestID != "" && capture.RequestID != requestID {
+			continue
+		}
+		result = append(result, capture)
+		if limit > 0 && len(result) == limit {
+			break
+		}
+	}
+	return result
+}
+
+func (c *BodyCapture) store(capture Capture) {
+	c.mu.Lock()
+	c.captures[c.next] = capture
+	c.next = (c.next + 1) % len(c.captures)
+	if c.next == 0 {
+		c.full = true
+	}
+	c.mu.Unlock()
+
+	if c.cfg.Log {
+		data, err := json.Marshal(capture)
+		if err != nil {
+			logger.Error("Error marshalling debug capture: %v", err)
+			return
+		}
+		logger.Info("debug capture: %s", data)
+	}
+}
+
+// enabled reports whether the request is on a captured route or is an admin
+// request asking to be captured
+func (c *BodyCapture) enabled(r *http.Request) bool {
+	for _, prefix := range c.cfg.Routes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	if r.Header.Get(DebugCaptureHeader) == "" {
+		return false
+	}
+	if role, ok := r.Context().Value(AuthUserRole).(string); ok {
+		return role == "admin"
+	}
+	// The capture runs ahead of route level authentication, check the token here
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return false
+	}
+	claims, err := auth.ParseJWT(token)
+	if err != nil {
+		return false
+	}
+	role, _ := claims["role"].(string)
+	return role == "admin"
+}
+
+// Middleware captures the bodies of enabled requests
+func (c *BodyCapture) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.enabled(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		requestBody := &limitedBuffer{limit: c.cfg.MaxBodyBytes}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(r.Body, requestBody), r.Body}
+		}
+		// Let inner handlers report the authenticated user
+		info, ok := r.Context().Value(requestInfoCtx).(*requestInfo)
+		if !ok {
+			info = &requestInfo{}
+		}
+
+		recorder := NewResponseRecorder(w)
+		recorder.CaptureBody(c.cfg.MaxBodyBytes)
+		next.ServeHTTP(recorder, r)
+
+		if recorder.Hijacked() {
+			return
+		}
+		c.store(Capture{
+			Time:                  start,
+			RequestID:             GetRequestID(r.Context()),
+			UserID:                info.user(),
+			Method:                r.Method,
+			Path:                  c.redactURI(r.URL),
+			Status:                recorder.Status(),
+			DurationMs:            float64(time.Since(start).Microseconds()) / 1000,
+			RequestHeaders:        c.redactHeaderValues(r.Header),
+			RequestBody:           c.redactBody(r.Header.Get("Content-Type"), requestBody.Bytes(), requestBody.truncated),
+			RequestBodyTruncated:  requestBody.truncated,
+			ResponseHeaders:       c.redactHeaderValues(recorder.Header()),
+			ResponseBody:          c.redactBody(recorder.Header().Get("Content-Type"), recorder.Body(), recorder.BodyTruncated()),
+			ResponseBodyTruncated: recorder.BodyTruncated(),
+		})
+	})
+}
+
+func (c *BodyCapture) redactHeaderValues(header http.Header) map[string][]string {
+	redacted := make(map[string][]string, len(header))
+	for name, values := range header {
+		if c.redactHeaders[name] {
+			redacted[name] = []string{redactedValue}
+			continue
+		}
+		redacted[name] = append([]string(nil), values...)
+	}
+	return redacted
+}
+
+// redactBody returns a printable body with redacted fields. Bodies that
+// cannot be parsed, and so cannot be redacted, are left out.
+func (c *BodyCapture) redactBody(contentType string, body []byte, truncated bool) string {
+	if len(body) == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var value interface{}
+		if truncated || json.Unmarshal(body, &value) != nil {
+			return fmt.Sprintf("[%d bytes of unparseable JSON omitted]", len(body))
+		}
+		data, err := json.Marshal(c.redactJSON(value))
+		if err != nil {
+			return fmt.Sprintf("[%d bytes omitted]", len(body))
+		}
+		return string(data)
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if truncated || err != nil {
+			return fmt.Sprintf("[%d bytes of unparseable form omitted]", len(body))
+		}
+		return c.redactValues(values).Encode()
+	case strings.HasPrefix(mediaType, "text/") && len(c.redactFields) == 0:
+		return string(body)
+	}
+	return fmt.Sprintf("[%d bytes of %s omitted]", len(body), mediaType)
+}
+
+// redactURI returns the request URI with the query redacted like a form body
+func (c *BodyCapture) redactURI(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.RequestURI()
+	}
+	return u.EscapedPath() + "?" + c.redactValues(u.Query()).Encode()
+}
+
+func (c *BodyCapture) redactValues(values url.Values) url.Values {
+	for key := range values {
+		if c.redactFields[strings.ToLower(key)] {
+			values[key] = []string{redactedValue}
+		}
+	}
+	return values
+}
+
+func (c *BodyCapture) redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if c.redactFields[strings.ToLower(key)] {
+				v[key] = redactedValue
+				continue
+			}
+			v[key] = c.redactJSON(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = c.redactJSON(child)
+		}
+	}
+	return value
+}
+
+// limitedBuffer keeps the first limit bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - int64(b.Len()); int64(len(p)) > remaining {
+		b.Buffer.Write(p[:max(remaining, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
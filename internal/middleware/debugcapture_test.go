@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/auth"
+	"github.com/NhyiraAmofaSekyi/go-webserver/utils"
+)
+
+func TestBodyCapture(t *testing.T) {
+	adminToken, err := auth.GenerateJWTWithRole("root", "admin")
+	if err != nil {
+		t.Fatalf("Could not generate admin token: %v", err)
+	}
+	userToken, err := auth.GenerateJWT("ama")
+	if err != nil {
+		t.Fatalf("Could not generate user token: %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		path             string
+		contentType      string
+		body             string
+		headers          map[string]string
+		expectCapture    bool
+		expectedPath     string
+		expectedRequest  string
+		expectedResponse string
+	}{
+		{
+			name:        "Not Enabled",
+			path:        "/api/v1/users/listObj",
+			contentType: "application/json",
+			body:        `{"name":"ama"}`,
+		},
+		{
+			name:             "Captured Route Redacts JSON Fields",
+			path:             "/api/v1/users/createUser",
+			contentType:      "application/json",
+			body:             `{"name":"ama","Password":"hunter2","profile":{"email":"ama@example.com"}}`,
+			expectCapture:    true,
+			expectedRequest:  `{"Password":"[REDACTED]","name":"ama","profile":{"email":"[REDACTED]"}}`,
+			expectedResponse: `{"id":"1","token":"[REDACTED]"}`,
+		},
+		{
+			name:            "Form Body",
+			path:            "/api/v1/users/createUser",
+			contentType:     "application/x-www-form-urlencoded",
+			body:            "name=ama&password=hunter2",
+			expectCapture:   true,
+			expectedRequest: "name=ama&password=%5BREDACTED%5D",
+		},
+		{
+			name:          "Query Is Redacted",
+			path:          "/api/v1/users/createUser?name=ama&token=secret&Email=ama@example.com",
+			contentType:   "application/x-www-form-urlencoded",
+			body:          "name=ama",
+			expectCapture: true,
+			expectedPath:  "/api/v1/users/createUser?Email=%5BREDACTED%5D&name=ama&token=%5BREDACTED%5D",
+		},
+		{
+			name:          "Truncated JSON Is Omitted",
+			path:          "/api/v1/users/createUser",
+			contentType:   "application/json",
+			body:          `{"name":"` + strings.Repeat("a", 100) + `"}`,
+			expectCapture: true,
+		},
+		{
+			name:          "Header From Admin",
+			path:          "/api/v1/users/getObj",
+			contentType:   "application/json",
+			body:          `{"key":"a.png"}`,
+			headers:       map[string]string{DebugCaptureHeader: "1", "Authorization": "Bearer " + adminToken},
+			expectCapture: true,
+		},
+		{
+			name:        "Header From Non Admin Is Ignored",
+			path:        "/api/v1/users/getObj",
+			contentType: "application/json",
+			body:        `{"key":"a.png"}`,
+			headers:     map[string]string{DebugCaptureHeader: "1", "Authorization": "Bearer " + userToken},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capture := NewBodyCapture(&BodyCaptureConfig{
+				MaxBodyBytes: 90,
+				RedactFields: []string{"password", "email", "token"},
+				Routes:       []string{"/api/v1/users/createUser"},
+			})
+			handler := RequestID(capture.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.ReadAll(r.Body)
+				if r.Header.Get("Content-Type") == "application/json" {
+					utils.RespondWithJSON(w, http.StatusCreated, map[string]string{"id": "1", "token": "secret"})
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+			})))
+
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusCreated {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+			}
+
+			captures := capture.Captures("", 0)
+			if !tt.expectCapture {
+				if len(captures) != 0 {
+					t.Fatalf("expected no capture, got %d", len(captures))
+				}
+				return
+			}
+			if len(captures) != 1 {
+				t.Fatalf("expected 1 capture, got %d", len(captures))
+			}
+			got := captures[0]
+			if got.RequestID == "" || got.RequestID != rr.Header().Get(RequestIDHeader) {
+				t.Errorf("capture has wrong request ID %q", got.RequestID)
+			}
+			if got.Status != http.StatusCreated {
+				t.Errorf("capture has wrong status: got %v want %v", got.Status, http.StatusCreated)
+			}
+			if values := got.RequestHeaders["Authorization"]; len(values) > 0 && values[0] != redactedValue {
+				t.Errorf("Authorization header not redacted: %v", values)
+			}
+			if tt.expectedPath != "" && got.Path != tt.expectedPath {
+				t.Errorf("wrong path:\n got %s\nwant %s", got.Path, tt.expectedPath)
+			}
+			if tt.expectedRequest != "" && got.RequestBody != tt.expectedRequest {
+				t.Errorf("wrong request body:\n got %s\nwant %s", got.RequestBody, tt.expectedRequest)
+			}
+			if tt.expectedResponse != "" && got.ResponseBody != tt.expectedResponse {
+				t.Errorf("wrong response body:\n got %s\nwant %s", got.ResponseBody, tt.expectedResponse)
+			}
+			for _, secret := range []string{"hunter2", "ama@example.com", "secret"} {
+				if strings.Contains(got.Path+got.RequestBody+got.ResponseBody, secret) {
+					t.Errorf("capture leaks %q", secret)
+				}
+			}
+		})
+	}
+}
+
+func TestBodyCaptureRingBuffer(t *testing.T) {
+	capture := NewBodyCapture(&BodyCaptureConfig{BufferSize: 3})
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		capture.store(Capture{RequestID: id})
+	}
+
+	captures := capture.Captures("", 0)
+	var ids []string
+	for _, c := range captures {
+		ids = append(ids, c.RequestID)
+	}
+	if strings.Join(ids, ",") != "e,d,c" {
+		t.Errorf("wrong captures kept: got %v want [e d c]", ids)
+	}
+	if got := capture.Captures("d", 0); len(got) != 1 || got[0].RequestID != "d" {
+		t.Errorf("filter by request ID returned %v", got)
+	}
+	if got := capture.Captures("", 2); len(got) != 2 {
+		t.Errorf("limit returned %d captures, want 2", len(got))
+	}
+}
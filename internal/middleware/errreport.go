@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/errreport"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/logger"
+	"github.com/NhyiraAmofaSekyi/go-webserver/utils"
+)
+
+// reportedHeaders are copied into reports, others may carry credentials
+var reportedHeaders = []string{"User-Agent", "Referer", "Content-Type", "Accept"}
+
+// errorRecorder keeps the message and stack of the first 5xx response
+type errorRecorder struct {
+	*ResponseRecorder
+	message   string
+	stack     []errreport.Frame
+	annotated bool
+}
+
+var _ utils.ErrorAnnotator = (*errorRecorder)(nil)
+
+// AnnotateError is called by utils.RespondWithError before it writes a 5xx
+func (rw *errorRecorder) AnnotateError(message string) {
+	if rw.annotated {
+		return
+	}
+	// Reported with the request, so the log record is not reported again
+	logger.ErrorContext(errreport.Skip(context.Background()), "Responding with 5XX error: "+message)
+	rw.annotate(message, errreport.CallerStack(1))
+}
+
+func (rw *errorRecorder) annotate(message string, stack []errreport.Frame) {
+	rw.annotated = true
+	rw.message = message
+	rw.stack = stack
+}
+
+func (rw *errorRecorder) WriteHeader(statusCode int) {
+	if statusCode >= http.StatusInternalServerError && !rw.WroteHeader() && !rw.annotated {
+		// Blame the handler writing the status, not the writers wrapping this one
+		stack := errreport.Stack(1)
+		for len(stack) > 1 && strings.HasSuffix(stack[0].Function, ".WriteHeader") {
+			stack = stack[1:]
+		}
+		rw.annotate(http.StatusText(statusCode), stack)
+	}
+	rw.ResponseRecorder.WriteHeader(statusCode)
+}
+
+// ErrorReporting recovers panics, answering 500 when nothing was written
+// yet, and reports them and 5xx responses to reporter with the request, the
+// user and the stack of the handler. It must run inside the access log and
+// Tracing so the route, user and trace ID are known.
+func ErrorReporting(reporter *errreport.Reporter) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wrapped := &errorRecorder{ResponseRecorder: NewResponseRecorder(w)}
+
+			defer func() {
+				if v := recover(); v != nil {
+					if v == http.ErrAbortHandler {
+						panic(v)
+					}
+					stack := errreport.PanicStack()
+					message := fmt.Sprint(v)
+					logger.ErrorContext(errreport.Skip(r.Context()), "Recovered from panic", "panic", message)
+
+					wroteHeader := wrapped.WroteHeader()
+					if !wroteHeader {
+						// Already reported as a panic
+						wrapped.annotated = true
+						utils.RespondWithError(wrapped, http.StatusInternalServerError, "Internal server error")
+					}
+					reporter.Report(errorReport(r, errreport.KindPanic, message, stack, http.StatusInternalServerError))
+					if wroteHeader {
+						// Part of the response is sent, close the connection
+						panic(http.ErrAbortHandler)
+					}
+					return
+				}
+
+				if status := wrapped.Status(); status >= http.StatusInternalServerError {
+					reporter.Report(errorReport(r, errreport.KindResponse, wrapped.message, wrapped.stack, status))
+				}
+			}()
+
+			next.ServeHTTP(wrapped, r)
+		})
+	}
+}
+
+func errorReport(r *http.Request, kind, message string, stack []errreport.Frame, status int) *errreport.Report {
+	report := &errreport.Report{
+		Kind:    kind,
+		Message: message,
+		Stack:   stack,
+		Request: &errreport.Request{
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Status:    status,
+			ClientIP:  ClientIP(r),
+			RequestID: GetRequestID(r.Context()),
+			Headers:   map[string]string{},
+		},
+		Tags: map[string]string{},
+	}
+	for _, header := range reportedHeaders {
+		if value := r.Header.Get(header); value != "" {
+			report.Request.Headers[header] = value
+		}
+	}
+	if info, ok := r.Context().Value(requestInfoCtx).(*requestInfo); ok {
+		if route := info.routePattern(); route != unmatchedRoute {
+			report.Request.Route = route
+			report.Tags["route"] = route
+		}
+		if user := info.user(); user != "" {
+			report.User = &errreport.User{ID: user}
+		}
+	}
+	if span := trace.SpanContextFromContext(r.Context()); span.HasTraceID() {
+		report.Tags["trace_id"] = span.TraceID().String()
+	}
+	return report
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/errreport"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/logger"
+	"github.com/NhyiraAmofaSekyi/go-webserver/utils"
+)
+
+func TestErrorReporting(t *testing.T) {
+	tests := []struct {
+		name            string
+		handler         http.HandlerFunc
+		expectedStatus  int
+		expectedKind    string
+		expectedMessage string
+	}{
+		{
+			name: "Panic",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic("nil map")
+			},
+			expectedStatus:  http.StatusInternalServerError,
+			expectedKind:    errreport.KindPanic,
+			expectedMessage: "nil map",
+		},
+		{
+			name: "RespondWithError",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				utils.RespondWithError(w, http.StatusInternalServerError, "database unavailable")
+			},
+			expectedStatus:  http.StatusInternalServerError,
+			expectedKind:    errreport.KindResponse,
+			expectedMessage: "database unavailable",
+		},
+		{
+			name: "WriteHeader",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+			expectedStatus:  http.StatusBadGateway,
+			expectedKind:    errreport.KindResponse,
+			expectedMessage: "Bad Gateway",
+		},
+		{
+			name: "Client Error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				utils.RespondWithError(w, http.StatusNotFound, "not found")
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				reports []errreport.Report
+			)
+			sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var report errreport.Report
+				json.NewDecoder(r.Body).Decode(&report)
+				mu.Lock()
+				reports = append(reports, report)
+				mu.Unlock()
+			}))
+			defer sink.Close()
+
+			reporter, err := errreport.New(&errreport.Config{Enabled: true, Webhook: errreport.WebhookSinkConfig{URL: sink.URL}})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			// Errors logged by the handler must not be reported twice
+			logger.AddHook(reporter.LogHook)
+
+			accessLog, err := NewAccessLog(&AccessLogConfig{Output: "file", File: logger.FileConfig{Dir: t.TempDir()}})
+			if err != nil {
+				t.Fatalf("NewAccessLog returned error: %v", err)
+			}
+			handler := accessLog(ErrorReporting(reporter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				SetRoutePattern(r.Context(), "/users/{id}")
+				setRequestUser(r.Context(), "ama")
+				tt.handler(w, r)
+			})))
+
+			req := httptest.NewRequest("GET", "/users/1", nil)
+			req.Header.Set("User-Agent", "test")
+			req.Header.Set("Authorization", "Bearer secret")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if err := reporter.Close(context.Background()); err != nil {
+				t.Fatalf("Close returned error: %v", err)
+			}
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+			}
+			if tt.expectedKind == "" {
+				if len(reports) != 0 {
+					t.Errorf("expected no reports, got %+v", reports)
+				}
+				return
+			}
+			if len(reports) != 1 {
+				t.Fatalf("expected 1 report, got %d: %+v", len(reports), reports)
+			}
+			report := reports[0]
+			if report.Kind != tt.expectedKind || report.Message != tt.expectedMessage {
+				t.Errorf("wrong report: got %s %q want %s %q", report.Kind, report.Message, tt.expectedKind, tt.expectedMessage)
+			}
+			if !strings.Contains(report.Culprit, "TestErrorReporting") {
+				t.Errorf("culprit should be the handler, got %q", report.Culprit)
+			}
+			if report.Request == nil || report.Request.Route != "/users/{id}" || report.Request.Status != tt.expectedStatus {
+				t.Errorf("wrong request in report: %+v", report.Request)
+			}
+			if _, ok := report.Request.Headers["Authorization"]; ok || report.Request.Headers["User-Agent"] != "test" {
+				t.Errorf("wrong headers in report: %v", report.Request.Headers)
+			}
+			if report.User == nil || report.User.ID != "ama" {
+				t.Errorf("wrong user in report: %+v", report.User)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/features"
+	"github.com/NhyiraAmofaSekyi/go-webserver/utils"
+)
+
+type FeaturesKey string
+
+const FeaturesCtx FeaturesKey = "middleware.features.service"
+
+// Features makes the feature flag service available to handlers through
+// FeatureEnabled
+func Features(service *features.Service) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), FeaturesCtx, service)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// FeatureEnabled reports whether the flag is on for the user authenticated
+// by AuthMiddleware, or for an anonymous request when there is none. It is
+// false when the Features middleware is not installed.
+func FeatureEnabled(r *http.Request, name string) bool {
+	service, ok := r.Context().Value(FeaturesCtx).(*features.Service)
+	if !ok {
+		return false
+	}
+	userID, _ := r.Context().Value(AuthUserID).(string)
+	role, _ := r.Context().Value(AuthUserRole).(string)
+	return service.IsEnabled(name, features.Subject{UserID: userID, Role: role})
+}
+
+// RequireFeature answers 404 for routes whose flag is off so that dark
+// endpoints look like they don't exist. Put it after AuthMiddleware for
+// user and role targeting to apply.
+func RequireFeature(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !FeatureEnabled(r, name) {
+				utils.RespondWithError(w, http.StatusNotFound, "route not found")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
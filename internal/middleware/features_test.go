@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/features"
+)
+
+func TestRequireFeature(t *testing.T) {
+	service, err := features.NewService([]features.Flag{
+		{Name: "reports", Enabled: true, Users: []string{"ama"}, Roles: []string{"admin"}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewService returned error: %v", err)
+	}
+
+	handler := Features(service)(RequireFeature("reports")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name           string
+		userID         string
+		role           string
+		expectedStatus int
+	}{
+		{name: "Anonymous", expectedStatus: http.StatusNotFound},
+		{name: "Targeted User", userID: "ama", expectedStatus: http.StatusOK},
+		{name: "Other User", userID: "kofi", expectedStatus: http.StatusNotFound},
+		{name: "Targeted Role", userID: "kofi", role: "admin", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/reports", nil)
+			ctx := context.WithValue(req.Context(), AuthUserID, tt.userID)
+			ctx = context.WithValue(ctx, AuthUserRole, tt.role)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req.WithContext(ctx))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/reports", nil)
+	if FeatureEnabled(req, "reports") {
+		t.Error("FeatureEnabled should be false without the Features middleware")
+	}
+}
@@ -0,0 +1,306 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/db/database"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/logger"
+	"github.com/NhyiraAmofaSekyi/go-webserver/utils"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	defaultIdempotencyTTL     = 24 * time.Hour
+	defaultIdempotencyReqMax  = 32 << 20 // 32MB
+	defaultIdempotencyRespMax = 1 << 20  // 1MB
+)
+
+type IdempotencyConfig struct {
+	TTL              time.Duration `yaml:"ttl"`
+	MaxRequestBytes  int64         `yaml:"max_request_bytes"`
+	MaxResponseBytes int64         `yaml:"max_response_bytes"`
+}
+
+// IdempotencyRecord is a stored request fingerprint and, once the request
+// has finished, the response to replay
+type IdempotencyRecord struct {
+	Fingerprint string
+	Completed   bool
+	StatusCode  int
+	Header      http.Header
+	Body        []byte
+}
+
+type IdempotencyStore interface {
+	// Reserve claims key for a new request. If an unexpired record already
+	// exists it is returned with reserved set to false.
+	Reserve(ctx context.Context, key string, fingerprint string, expiresAt time.Time) (record *IdempotencyRecord, reserved bool, err error)
+	// Complete stores the response for a reserved key
+	Complete(ctx context.Context, key string, record *IdempotencyRecord) error
+	// Release removes a reserved key so the request can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// PostgresIdempotencyStore keeps idempotency records in the idempotency_keys table
+type PostgresIdempotencyStore struct {
+	db *database.Queries
+}
+
+func NewPostgresIdempotencyStore(db *database.Queries) *PostgresIdempotencyStore {
+	return &PostgresIdempotencyStore{db: db}
+}
+
+func (s *PostgresIdempotencyStore) Reserve(ctx context.Context, key string, fingerprint string, expiresAt time.Time) (*IdempotencyRecord, bool, error) {
+	_, err := s.db.ReserveIdempotencyKey(ctx, database.ReserveIdempotencyKeyParams{
+		Key:         key,
+		Fingerprint: fingerprint,
+		ExpiresAt:   expiresAt,
+	})
+	if err == nil {
+		return nil, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+
+	// The key exists and has not expired yet
+	row, err := s.db.GetIdempotencyKey(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+	record := &IdempotencyRecord{
+		Fingerprint: row.Fingerprint,
+		Completed:   row.StatusCode.Valid,
+		StatusCode:  int(row.StatusCode.Int32),
+		Body:        row.ResponseBody,
+	}
+	if len(row.ResponseHeaders) > 0 {
+		if err := json.Unmarshal(row.ResponseHeaders, &record.Header); err != nil {
+			return nil, false, err
+		}
+	}
+	return record, false, nil
+}
+
+func (s *PostgresIdempotencyStore) Complete(ctx context.Context, key string, record *IdempotencyRecord) error {
+	headers, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+	return s.db.CompleteIdempotencyKey(ctx, database.CompleteIdempotencyKeyParams{
+		Key:             key,
+		StatusCode:      sql.NullInt32{Int32: int32(record.StatusCode), Valid: true},
+		ResponseHeaders: headers,
+		ResponseBody:    record.Body,
+	})
+}
+
+func (s *PostgresIdempotencyStore) Release(ctx context.Context, key string) error {
+	return s.db.DeleteIdempotencyKey(ctx, key)
+}
+
+// PurgeExpired deletes records whose TTL has passed
+func (s *PostgresIdempotencyStore) PurgeExpired(ctx context.Context) error {
+	return s.db.DeleteExpiredIdempotencyKeys(ctx)
+}
+
+// idempotencyStoreKey scopes the client key to the route and authenticated user
+func idempotencyStoreKey(r *http.Request, key string) string {
+	userID, _ := r.Context().Value(AuthUserID).(string)
+	sum := sha256.Sum256([]byte(r.Method + "\n" + r.URL.Path + "\n" + userID + "\n" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// requestFingerprint identifies the request so a reused key with a different body can be rejected
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	contentType := r.Header.Get("Content-Type")
+	if mediaType, params, err := mime.ParseMediaType(contentType); err == nil && mediaType == "multipart/form-data" {
+		// A client rebuilding the form on retry picks a new random boundary
+		if parts, err := multipartFingerprint(body, params["boundary"]); err == nil {
+			io.WriteString(h, r.Method+"\n"+r.URL.RequestURI()+"\n"+mediaType+"\n"+parts)
+			return hex.EncodeToString(h.Sum(nil))
+		}
+	}
+	io.WriteString(h, r.Method+"\n"+r.URL.RequestURI()+"\n"+contentType+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// multipartFingerprint describes each part of a multipart body by its field
+// name, file name, content type and a hash of its content, leaving out the
+// boundary
+func multipartFingerprint(body []byte, boundary string) (string, error) {
+	if boundary == "" {
+		return "", errors.New("missing multipart boundary")
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	var parts []string
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		content := sha256.New()
+		if _, err := io.Copy(content, part); err != nil {
+			return "", err
+		}
+		parts = append(parts, strings.Join([]string{
+			strconv.Quote(part.FormName()),
+			strconv.Quote(part.FileName()),
+			strconv.Quote(part.Header.Get("Content-Type")),
+			hex.EncodeToString(content.Sum(nil)),
+		}, " "))
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+// replayableHeaders returns the headers set by the handler, leaving out
+// headers added by outer middleware (CORS, security headers) before it ran
+// and headers that must not be replayed verbatim
+func replayableHeaders(before, after http.Header) http.Header {
+	stored := http.Header{}
+	for name, values := range after {
+		if slices.Equal(before[name], values) {
+			continue
+		}
+		stored[name] = slices.Clone(values)
+	}
+	for _, name := range []string{"Date", "Set-Cookie", "Content-Length"} {
+		stored.Del(name)
+	}
+	return stored
+}
+
+func replayIdempotentResponse(w http.ResponseWriter, record *IdempotencyRecord) {
+	for name, values := range record.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Body)
+}
+
+// Idempotency returns a middleware that honours the Idempotency-Key header on
+// POST requests. The first request with a key is executed and its response
+// stored; retries with the same key and body get the stored response, while
+// a retry with a different body is rejected with 422 and a retry that
+// arrives before the first request finished is rejected with 409.
+func Idempotency(store IdempotencyStore, config *IdempotencyConfig) Middleware {
+	cfg := IdempotencyConfig{
+		TTL:              defaultIdempotencyTTL,
+		MaxRequestBytes:  defaultIdempotencyReqMax,
+		MaxResponseBytes: defaultIdempotencyRespMax,
+	}
+	if config != nil {
+		if config.TTL > 0 {
+			cfg.TTL = config.TTL
+		}
+		if config.MaxRequestBytes > 0 {
+			cfg.MaxRequestBytes = config.MaxRequestBytes
+		}
+		if config.MaxResponseBytes > 0 {
+			cfg.MaxResponseBytes = config.MaxResponseBytes
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || r.Method != http.MethodPost {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				utils.RespondWithError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxRequestBytes))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					utils.RespondWithError(w, http.StatusRequestEntityTooLarge, "request body too large")
+					return
+				}
+				utils.RespondWithError(w, http.StatusBadRequest, "error reading request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			storeKey := idempotencyStoreKey(r, key)
+			fingerprint := requestFingerprint(r, body)
+
+			record, reserved, err := store.Reserve(r.Context(), storeKey, fingerprint, time.Now().Add(cfg.TTL))
+			if err != nil {
+				logger.Error("Idempotency store reserve failed: %v", err)
+				utils.RespondWithError(w, http.StatusServiceUnavailable, "idempotency store unavailable")
+				return
+			}
+			if !reserved {
+				switch {
+				case record.Fingerprint != fingerprint:
+					utils.RespondWithError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request")
+				case !record.Completed:
+					utils.RespondWithError(w, http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+				default:
+					replayIdempotentResponse(w, record)
+				}
+				return
+			}
+
+			// Store updates must not be cancelled when the client goes away
+			storeCtx := context.WithoutCancel(r.Context())
+			completed := false
+			defer func() {
+				if !completed {
+					if err := store.Release(storeCtx, storeKey); err != nil {
+						logger.Error("Idempotency store release failed: %v", err)
+					}
+				}
+			}()
+
+			headersBefore := w.Header().Clone()
+			recorder := NewResponseRecorder(w)
+			recorder.CaptureBody(cfg.MaxResponseBytes)
+			next.ServeHTTP(recorder, r)
+
+			// Server errors and oversized responses are not stored so the client can retry
+			if recorder.Status() >= http.StatusInternalServerError || recorder.BodyTruncated() || recorder.Hijacked() {
+				return
+			}
+
+			err = store.Complete(storeCtx, storeKey, &IdempotencyRecord{
+				Fingerprint: fingerprint,
+				Completed:   true,
+				StatusCode:  recorder.Status(),
+				Header:      replayableHeaders(headersBefore, recorder.Header()),
+				Body:        recorder.Body(),
+			})
+			if err != nil {
+				logger.Error("Idempotency store complete failed: %v", err)
+				return
+			}
+			completed = true
+		})
+	}
+}
@@ -0,0 +1,427 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/db/database"
+)
+
+// memoryIdempotencyStore is an in-memory IdempotencyStore for tests
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*IdempotencyRecord
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{records: make(map[string]*IdempotencyRecord)}
+}
+
+func (s *memoryIdempotencyStore) Reserve(ctx context.Context, key string, fingerprint string, expiresAt time.Time) (*IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.records[key]; ok {
+		return record, false, nil
+	}
+	s.records[key] = &IdempotencyRecord{Fingerprint: fingerprint}
+	return nil, true, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(ctx context.Context, key string, record *IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = record
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func TestIdempotency(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	calls := 0
+	handler := Idempotency(store, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if strings.Contains(r.URL.Path, "fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	}))
+
+	tests := []struct {
+		name             string
+		method           string
+		path             string
+		key              string
+		body             string
+		expectedStatus   int
+		expectedCalls    int
+		expectedReplayed string
+	}{
+		{
+			name:           "First Request Executes",
+			method:         "POST",
+			path:           "/users/createUser",
+			key:            "abc",
+			body:           `{"name":"kofi"}`,
+			expectedStatus: http.StatusCreated,
+			expectedCalls:  1,
+		},
+		{
+			name:             "Retry Is Replayed",
+			method:           "POST",
+			path:             "/users/createUser",
+			key:              "abc",
+			body:             `{"name":"kofi"}`,
+			expectedStatus:   http.StatusCreated,
+			expectedCalls:    1,
+			expectedReplayed: "true",
+		},
+		{
+			name:           "Same Key Different Body",
+			method:         "POST",
+			path:           "/users/createUser",
+			key:            "abc",
+			body:           `{"name":"ama"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCalls:  1,
+		},
+		{
+			name:           "Same Key Different Route",
+			method:         "POST",
+			path:           "/users/upload",
+			key:            "abc",
+			body:           `{"name":"ama"}`,
+			expectedStatus: http.StatusCreated,
+			expectedCalls:  2,
+		},
+		{
+			name:           "No Key Is Not Deduplicated",
+			method:         "POST",
+			path:           "/users/createUser",
+			body:           `{"name":"kofi"}`,
+			expectedStatus: http.StatusCreated,
+			expectedCalls:  3,
+		},
+		{
+			name:           "Server Error Is Not Stored",
+			method:         "POST",
+			path:           "/fail",
+			key:            "def",
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  4,
+		},
+		{
+			name:           "Server Error Can Be Retried",
+			method:         "POST",
+			path:           "/fail",
+			key:            "def",
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  5,
+		},
+		{
+			name:           "GET Ignores Key",
+			method:         "GET",
+			path:           "/users/createUser",
+			key:            "abc",
+			expectedStatus: http.StatusCreated,
+			expectedCalls:  6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.key != "" {
+				req.Header.Set(IdempotencyKeyHeader, tt.key)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if calls != tt.expectedCalls {
+				t.Errorf("handler was called %d times, want %d", calls, tt.expectedCalls)
+			}
+			if got := rr.Header().Get(IdempotentReplayedHeader); got != tt.expectedReplayed {
+				t.Errorf("wrong %s header: got %q want %q", IdempotentReplayedHeader, got, tt.expectedReplayed)
+			}
+			if tt.expectedReplayed != "" {
+				if rr.Body.String() != `{"id":1}` {
+					t.Errorf("replayed body mismatch: %s", rr.Body.String())
+				}
+				if rr.Header().Get("Content-Type") != "application/json" {
+					t.Errorf("replayed Content-Type mismatch: %s", rr.Header().Get("Content-Type"))
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := Idempotency(store, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest("POST", "/users/upload", strings.NewReader("file"))
+		req.Header.Set(IdempotencyKeyHeader, "slow")
+		return req
+	}
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), newRequest())
+		close(done)
+	}()
+	<-started
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest())
+	if rr.Code != http.StatusConflict {
+		t.Errorf("concurrent retry returned wrong status code: got %v want %v", rr.Code, http.StatusConflict)
+	}
+
+	close(release)
+	<-done
+}
+
+// uploadRequest builds a multipart upload of content with the given boundary
+func uploadRequest(t *testing.T, boundary, content string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.SetBoundary(boundary); err != nil {
+		t.Fatalf("SetBoundary returned error: %v", err)
+	}
+	form.WriteField("description", "avatar")
+	file, err := form.CreateFormFile("file", "avatar.png")
+	if err != nil {
+		t.Fatalf("CreateFormFile returned error: %v", err)
+	}
+	io.WriteString(file, content)
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/users/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set(IdempotencyKeyHeader, "upload-1")
+	return req
+}
+
+func TestIdempotencyMultipart(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	calls := 0
+	handler := Idempotency(store, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	tests := []struct {
+		name             string
+		boundary         string
+		content          string
+		expectedStatus   int
+		expectedReplayed string
+	}{
+		{name: "First Upload", boundary: "boundary-one", content: "png bytes", expectedStatus: http.StatusCreated},
+		{name: "Rebuilt Form Is Replayed", boundary: "boundary-two", content: "png bytes", expectedStatus: http.StatusCreated, expectedReplayed: "true"},
+		{name: "Different File Is Rejected", boundary: "boundary-three", content: "other bytes", expectedStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, uploadRequest(t, tt.boundary, tt.content))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if got := rr.Header().Get(IdempotentReplayedHeader); got != tt.expectedReplayed {
+				t.Errorf("wrong %s header: got %q want %q", IdempotentReplayedHeader, got, tt.expectedReplayed)
+			}
+		})
+	}
+	if calls != 1 {
+		t.Errorf("handler was called %d times, want 1", calls)
+	}
+}
+
+// idempotencyRow is a row of the idempotency_keys table in fakeIdempotencyDB
+type idempotencyRow struct {
+	fingerprint string
+	statusCode  any
+	headers     any
+	body        any
+	createdAt   time.Time
+	expiresAt   time.Time
+}
+
+// fakeIdempotencyDB is a database/sql driver answering the sqlc idempotency
+// queries from memory, so PostgresIdempotencyStore runs without a database
+type fakeIdempotencyDB struct {
+	mu   sync.Mutex
+	rows map[string]*idempotencyRow
+}
+
+func (d *fakeIdempotencyDB) Open(name string) (driver.Conn, error) { return d, nil }
+func (d *fakeIdempotencyDB) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+func (d *fakeIdempotencyDB) Close() error { return nil }
+func (d *fakeIdempotencyDB) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (d *fakeIdempotencyDB) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := args[0].Value.(string)
+	row, exists := d.rows[key]
+	switch {
+	case strings.Contains(query, "-- name: ReserveIdempotencyKey"):
+		if exists && row.expiresAt.After(time.Now()) {
+			return &fakeRows{}, nil
+		}
+		row = &idempotencyRow{
+			fingerprint: args[1].Value.(string),
+			createdAt:   time.Now(),
+			expiresAt:   args[2].Value.(time.Time),
+		}
+		d.rows[key] = row
+	case strings.Contains(query, "-- name: GetIdempotencyKey"):
+		if !exists {
+			return &fakeRows{}, nil
+		}
+	default:
+		return nil, errors.New("unexpected query: " + query)
+	}
+	return &fakeRows{values: [][]driver.Value{{key, row.fingerprint, row.statusCode, row.headers, row.body, row.createdAt, row.expiresAt}}}, nil
+}
+
+func (d *fakeIdempotencyDB) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case strings.Contains(query, "-- name: CompleteIdempotencyKey"):
+		if row, ok := d.rows[args[0].Value.(string)]; ok {
+			row.statusCode, row.headers, row.body = args[1].Value, args[2].Value, args[3].Value
+		}
+	case strings.Contains(query, "-- name: DeleteIdempotencyKey"):
+		delete(d.rows, args[0].Value.(string))
+	case strings.Contains(query, "-- name: DeleteExpiredIdempotencyKeys"):
+		for key, row := range d.rows {
+			if row.expiresAt.Before(time.Now()) {
+				delete(d.rows, key)
+			}
+		}
+	default:
+		return nil, errors.New("unexpected query: " + query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+type fakeRows struct {
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"key", "fingerprint", "status_code", "response_headers", "response_body", "created_at", "expires_at"}
+}
+func (r *fakeRows) Close() error { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+var fakeIdempotencyDriver = &fakeIdempotencyDB{rows: make(map[string]*idempotencyRow)}
+
+func init() {
+	sql.Register("fake-idempotency", fakeIdempotencyDriver)
+}
+
+func TestPostgresIdempotencyStore(t *testing.T) {
+	conn, err := sql.Open("fake-idempotency", "")
+	if err != nil {
+		t.Fatalf("sql.Open returned error: %v", err)
+	}
+	defer conn.Close()
+	store := NewPostgresIdempotencyStore(database.New(conn))
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour)
+
+	if _, reserved, err := store.Reserve(ctx, "key", "fp", expiresAt); err != nil || !reserved {
+		t.Fatalf("first Reserve: reserved=%v err=%v, want a reservation", reserved, err)
+	}
+
+	record, reserved, err := store.Reserve(ctx, "key", "fp", expiresAt)
+	if err != nil || reserved {
+		t.Fatalf("Reserve while in progress: reserved=%v err=%v", reserved, err)
+	}
+	if record.Fingerprint != "fp" || record.Completed {
+		t.Errorf("in progress record: got %+v", record)
+	}
+
+	err = store.Complete(ctx, "key", &IdempotencyRecord{
+		StatusCode: http.StatusCreated,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       []byte(`{"id":1}`),
+	})
+	if err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+	record, reserved, err = store.Reserve(ctx, "key", "fp", expiresAt)
+	if err != nil || reserved {
+		t.Fatalf("Reserve after Complete: reserved=%v err=%v", reserved, err)
+	}
+	if !record.Completed || record.StatusCode != http.StatusCreated || string(record.Body) != `{"id":1}` || record.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("completed record: got %+v", record)
+	}
+
+	if err := store.Release(ctx, "key"); err != nil {
+		t.Fatalf("Release returned error: %v", err)
+	}
+	if _, reserved, err := store.Reserve(ctx, "key", "fp", time.Now().Add(-time.Second)); err != nil || !reserved {
+		t.Fatalf("Reserve after Release: reserved=%v err=%v, want a reservation", reserved, err)
+	}
+
+	// Expired keys can be reserved again and are purged
+	if _, reserved, err := store.Reserve(ctx, "key", "other", expiresAt); err != nil || !reserved {
+		t.Errorf("Reserve of expired key: reserved=%v err=%v, want a reservation", reserved, err)
+	}
+	store.Reserve(ctx, "stale", "fp", time.Now().Add(-time.Second))
+	if err := store.PurgeExpired(ctx); err != nil {
+		t.Fatalf("PurgeExpired returned error: %v", err)
+	}
+	if _, ok := fakeIdempotencyDriver.rows["stale"]; ok {
+		t.Error("expired key was not purged")
+	}
+}
@@ -0,0 +1,296 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	monitoring "github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
+	"github.com/NhyiraAmofaSekyi/go-webserver/utils"
+)
+
+// Priority classes for load shedding
+const (
+	PriorityCritical = "critical" // never limited or shed
+	PriorityHigh     = "high"     // queued ahead of normal requests
+	PriorityNormal   = "normal"
+	PriorityLow      = "low" // shed instead of queued once the limit is reached
+)
+
+const (
+	defaultQueueTimeout    = time.Second
+	defaultShedRetryAfter  = time.Second
+	adaptiveDecreaseFactor = 0.9
+)
+
+// ConcurrencyLimit configures one limiter. A zero Limit disables limiting.
+type ConcurrencyLimit struct {
+	Limit        int           `yaml:"limit"`         // maximum requests in flight
+	QueueSize    int           `yaml:"queue_size"`    // requests allowed to wait for a slot
+	QueueTimeout time.Duration `yaml:"queue_timeout"` // how long a queued request waits before being shed
+	// TargetLatency turns on adaptive limiting: the limit shrinks while
+	// requests take longer than this and grows back up to Limit when they
+	// don't, but never below MinLimit
+	TargetLatency time.Duration `yaml:"target_latency"`
+	MinLimit      int           `yaml:"min_limit"`
+}
+
+type ConcurrencyRouteLimit struct {
+	Prefix           string `yaml:"prefix"`
+	ConcurrencyLimit `yaml:",inline"`
+}
+
+type ConcurrencyPriority struct {
+	Prefix string `yaml:"prefix"` // exact path, or every path below it when ending in "/"
+	Class  string `yaml:"class"`
+}
+
+type LoadSheddingConfig struct {
+	Default    ConcurrencyLimit        `yaml:"default"`
+	Routes     []ConcurrencyRouteLimit `yaml:"routes"` // longest matching prefix wins
+	Priorities []ConcurrencyPriority   `yaml:"priorities"`
+	RetryAfter time.Duration           `yaml:"retry_after"`
+}
+
+type waiter struct {
+	ready    chan struct{}
+	priority string
+}
+
+// limiter bounds the requests in flight for one route group
+type limiter struct {
+	name          string
+	mu            sync.Mutex
+	limit         float64
+	minLimit      float64
+	maxLimit      float64
+	targetLatency time.Duration
+	inflight      int
+	queue         []*waiter
+	queueSize     int
+	queueTimeout  time.Duration
+}
+
+func newLimiter(name string, config ConcurrencyLimit) *limiter {
+	l := &limiter{
+		name:          name,
+		limit:         float64(config.Limit),
+		maxLimit:      float64(config.Limit),
+		minLimit:      float64(config.MinLimit),
+		targetLatency: config.TargetLatency,
+		queueSize:     config.QueueSize,
+		queueTimeout:  config.QueueTimeout,
+	}
+	if l.minLimit < 1 {
+		l.minLimit = 1
+	}
+	if l.queueTimeout <= 0 {
+		l.queueTimeout = defaultQueueTimeout
+	}
+	monitoring.HttpConcurrencyLimit.WithLabelValues(name).Set(l.limit)
+	return l
+}
+
+// acquire waits for a slot and returns an empty reason on success, or the
+// reason the request was shed
+func (l *limiter) acquire(r *http.Request, priority string) string {
+	l.mu.Lock()
+	if l.inflight < int(l.limit) && len(l.queue) == 0 {
+		l.inflight++
+		l.mu.Unlock()
+		return ""
+	}
+	if priority == PriorityLow {
+		l.mu.Unlock()
+		return "low_priority"
+	}
+	if len(l.queue) >= l.queueSize {
+		l.mu.Unlock()
+		return "queue_full"
+	}
+
+	w := &waiter{ready: make(chan struct{}), priority: priority}
+	if priority == PriorityHigh {
+		// Queue behind other high priority requests but ahead of normal ones
+		i := sort.Search(len(l.queue), func(i int) bool { return l.queue[i].priority != PriorityHigh })
+		l.queue = append(l.queue[:i], append([]*waiter{w}, l.queue[i:]...)...)
+	} else {
+		l.queue = append(l.queue, w)
+	}
+	monitoring.HttpQueuedRequests.WithLabelValues(l.name).Set(float64(len(l.queue)))
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	reason := ""
+	select {
+	case <-w.ready:
+		return ""
+	case <-timer.C:
+		reason = "queue_timeout"
+	case <-r.Context().Done():
+		reason = "canceled"
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, queued := range l.queue {
+		if queued == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			monitoring.HttpQueuedRequests.WithLabelValues(l.name).Set(float64(len(l.queue)))
+			return reason
+		}
+	}
+	// A slot was handed over while we were giving up
+	return ""
+}
+
+// release frees a slot, adapts the limit to the request's latency and hands
+// freed slots to queued requests
+func (l *limiter) release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight--
+	if l.targetLatency > 0 {
+		if latency > l.targetLatency {
+			l.limit = max(l.minLimit, l.limit*adaptiveDecreaseFactor)
+		} else {
+			l.limit = min(l.maxLimit, l.limit+1/l.limit)
+		}
+		monitoring.HttpConcurrencyLimit.WithLabelValues(l.name).Set(l.limit)
+	}
+
+	for len(l.queue) > 0 && l.inflight < int(l.limit) {
+		next := l.queue[0]
+		l.queue = l.queue[1:]
+		l.inflight++
+		close(next.ready)
+	}
+	monitoring.HttpQueuedRequests.WithLabelValues(l.name).Set(float64(len(l.queue)))
+}
+
+type routeLimiter struct {
+	prefix  string
+	limiter *limiter
+}
+
+type loadShedder struct {
+	defaultLimiter *limiter
+	routes         []routeLimiter // sorted by descending prefix length
+	priorities     []ConcurrencyPriority
+	retryAfter     string
+}
+
+// NewLoadShedder returns a middleware that limits concurrent requests per
+// route and answers with 503 and Retry-After once a limiter and its queue
+// are full. Critical requests are never limited.
+func NewLoadShedder(config *LoadSheddingConfig) (Middleware, error) {
+	if config == nil {
+		config = &LoadSheddingConfig{}
+	}
+
+	s := &loadShedder{priorities: config.Priorities}
+	retryAfter := config.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = defaultShedRetryAfter
+	}
+	s.retryAfter = strconv.Itoa(int(retryAfter.Round(time.Second).Seconds()))
+
+	for _, p := range config.Priorities {
+		switch p.Class {
+		case PriorityCritical, PriorityHigh, PriorityNormal, PriorityLow:
+		default:
+			return nil, fmt.Errorf("unknown priority class %q for %q", p.Class, p.Prefix)
+		}
+	}
+
+	validate := func(name string, limit ConcurrencyLimit) error {
+		if limit.Limit < 0 || limit.QueueSize < 0 || limit.MinLimit < 0 {
+			return fmt.Errorf("%s: limits must not be negative", name)
+		}
+		if limit.MinLimit > limit.Limit {
+			return fmt.Errorf("%s: min_limit %d is above limit %d", name, limit.MinLimit, limit.Limit)
+		}
+		return nil
+	}
+
+	if err := validate("default", config.Default); err != nil {
+		return nil, err
+	}
+	if config.Default.Limit > 0 {
+		s.defaultLimiter = newLimiter("default", config.Default)
+	}
+	for _, route := range config.Routes {
+		if err := validate(route.Prefix, route.ConcurrencyLimit); err != nil {
+			return nil, err
+		}
+		rl := routeLimiter{prefix: route.Prefix}
+		if route.Limit > 0 {
+			rl.limiter = newLimiter(route.Prefix, route.ConcurrencyLimit)
+		}
+		s.routes = append(s.routes, rl)
+	}
+	sort.SliceStable(s.routes, func(i, j int) bool {
+		return len(s.routes[i].prefix) > len(s.routes[j].prefix)
+	})
+
+	return s.middleware, nil
+}
+
+func (s *loadShedder) priority(path string) string {
+	class, matched := PriorityNormal, -1
+	for _, p := range s.priorities {
+		if (path == p.Prefix || (strings.HasSuffix(p.Prefix, "/") && strings.HasPrefix(path, p.Prefix))) && len(p.Prefix) > matched {
+			class, matched = p.Class, len(p.Prefix)
+		}
+	}
+	return class
+}
+
+// limiterFor returns the limiter of the longest matching route, nil if unlimited
+func (s *loadShedder) limiterFor(path string) *limiter {
+	for _, route := range s.routes {
+		if strings.HasPrefix(path, route.prefix) {
+			return route.limiter
+		}
+	}
+	return s.defaultLimiter
+}
+
+func (s *loadShedder) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		priority := s.priority(r.URL.Path)
+		l := s.limiterFor(r.URL.Path)
+		if priority == PriorityCritical || l == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if reason := l.acquire(r, priority); reason != "" {
+			monitoring.HttpShedRequestsTotal.WithLabelValues(l.name, reason).Inc()
+			// Not RespondWithError, shedding is expected under load and must stay cheap
+			w.Header().Set("Retry-After", s.retryAfter)
+			utils.RespondWithJSON(w, http.StatusServiceUnavailable, utils.ErrorResponse{
+				Error:     "server is overloaded, retry later",
+				Code:      utils.ErrCodeUnavailable,
+				RequestID: GetRequestID(r.Context()),
+			})
+			return
+		}
+
+		inFlight := monitoring.HttpConcurrencyInFlight.WithLabelValues(l.name)
+		inFlight.Inc()
+		start := time.Now()
+		defer func() {
+			inFlight.Dec()
+			l.release(time.Since(start))
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
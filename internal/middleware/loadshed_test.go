@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
+)
+
+// concurrencyInFlight returns http_concurrency_in_flight for limiter
+func concurrencyInFlight(t *testing.T, limiter string) float64 {
+	t.Helper()
+	families, err := monitoring.Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "http_concurrency_in_flight" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if metric.GetLabel()[0].GetValue() == limiter {
+				return metric.GetGauge().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestLoadShedder(t *testing.T) {
+	shedder, err := NewLoadShedder(&LoadSheddingConfig{
+		Default: ConcurrencyLimit{Limit: 1, QueueSize: 1, QueueTimeout: 50 * time.Millisecond},
+		Routes: []ConcurrencyRouteLimit{
+			{Prefix: "/unlimited/"},
+		},
+		Priorities: []ConcurrencyPriority{
+			{Prefix: "/healthz", Class: PriorityCritical},
+			{Prefix: "/batch/", Class: PriorityLow},
+		},
+		RetryAfter: 3 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewLoadShedder returned error: %v", err)
+	}
+
+	started := make(chan struct{}, 10)
+	unblock := make(chan struct{})
+	handler := shedder(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-unblock
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	// Occupy the only slot
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serve("/slow")
+	}()
+	<-started
+
+	if got := concurrencyInFlight(t, "default"); got != 1 {
+		t.Errorf("wrong requests in flight for the default limiter: got %v want 1", got)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "Critical Is Never Shed", path: "/healthz", expectedStatus: http.StatusOK},
+		{name: "Unlimited Route", path: "/unlimited/report", expectedStatus: http.StatusOK},
+		{name: "Low Priority Is Not Queued", path: "/batch/job", expectedStatus: http.StatusServiceUnavailable},
+		{name: "Queue Timeout", path: "/api", expectedStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(tt.path)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if rr.Code == http.StatusServiceUnavailable && rr.Header().Get("Retry-After") != "3" {
+				t.Errorf("wrong Retry-After header: got %q want %q", rr.Header().Get("Retry-After"), "3")
+			}
+		})
+	}
+
+	t.Run("Queue Full", func(t *testing.T) {
+		queued := make(chan int, 1)
+		go func() {
+			queued <- serve("/api").Code
+		}()
+		// Give the first request time to enter the queue
+		time.Sleep(10 * time.Millisecond)
+		if rr := serve("/api"); rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusServiceUnavailable)
+		}
+		<-queued
+	})
+
+	t.Run("Queued Request Gets Released Slot", func(t *testing.T) {
+		queued := make(chan int, 1)
+		go func() {
+			queued <- serve("/api").Code
+		}()
+		time.Sleep(10 * time.Millisecond)
+		close(unblock)
+		if code := <-queued; code != http.StatusOK {
+			t.Errorf("queued request got %v want %v", code, http.StatusOK)
+		}
+	})
+	wg.Wait()
+}
+
+func TestLimiterPriorityQueue(t *testing.T) {
+	l := newLimiter("test-priority", ConcurrencyLimit{Limit: 1, QueueSize: 3, QueueTimeout: time.Second})
+	req := httptest.NewRequest("GET", "/", nil)
+	if reason := l.acquire(req, PriorityNormal); reason != "" {
+		t.Fatalf("first acquire shed: %s", reason)
+	}
+
+	order := make(chan string, 2)
+	acquire := func(priority string) {
+		if reason := l.acquire(req, priority); reason == "" {
+			order <- priority
+			l.release(0)
+		}
+	}
+	go acquire(PriorityNormal)
+	time.Sleep(10 * time.Millisecond)
+	go acquire(PriorityHigh)
+	time.Sleep(10 * time.Millisecond)
+
+	l.release(0)
+	if first := <-order; first != PriorityHigh {
+		t.Errorf("wrong request served first: got %s want %s", first, PriorityHigh)
+	}
+	<-order
+}
+
+func TestAdaptiveLimit(t *testing.T) {
+	l := newLimiter("test-adaptive", ConcurrencyLimit{Limit: 10, MinLimit: 2, TargetLatency: 100 * time.Millisecond})
+	req := httptest.NewRequest("GET", "/", nil)
+
+	for i := 0; i < 50; i++ {
+		l.acquire(req, PriorityNormal)
+		l.release(time.Second)
+	}
+	if l.limit != 2 {
+		t.Errorf("limit did not shrink to the minimum: got %v want 2", l.limit)
+	}
+
+	for i := 0; i < 200; i++ {
+		l.acquire(req, PriorityNormal)
+		l.release(time.Millisecond)
+	}
+	if l.limit != 10 {
+		t.Errorf("limit did not recover to the maximum: got %v want 10", l.limit)
+	}
+}
+
+func TestInvalidLoadSheddingConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config LoadSheddingConfig
+	}{
+		{name: "Unknown Priority", config: LoadSheddingConfig{Priorities: []ConcurrencyPriority{{Prefix: "/", Class: "urgent"}}}},
+		{name: "Min Above Limit", config: LoadSheddingConfig{Default: ConcurrencyLimit{Limit: 1, MinLimit: 2}}},
+		{name: "Negative Queue", config: LoadSheddingConfig{Routes: []ConcurrencyRouteLimit{{Prefix: "/a", ConcurrencyLimit: ConcurrencyLimit{QueueSize: -1}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewLoadShedder(&tt.config); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
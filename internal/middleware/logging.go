@@ -2,49 +2,344 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+
 	"github.com/NhyiraAmofaSekyi/go-webserver/internal/logger"
 	monitoring "github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
 )
 
-type wrappedWriter struct {
-	http.ResponseWriter
-	statusCode int
-}
-
 type ReqTime string
 
 const ReqStartTime ReqTime = "reqStartTime"
 
-func (w *wrappedWriter) WriteHeader(statusCode int) {
-	w.ResponseWriter.WriteHeader(statusCode)
-	w.statusCode = statusCode
+// Access log formats
+const (
+	AccessLogDefault  = "default"  // the application log line "<status> <method> <path> <duration>"
+	AccessLogCommon   = "common"   // NCSA Common Log Format
+	AccessLogCombined = "combined" // Common Log Format plus referer and user agent
+	AccessLogJSON     = "json"
+)
+
+type AccessLogConfig struct {
+	// Service is the service label of the HTTP metrics, "api" when empty
+	Service string `yaml:"service"`
+	Format  string `yaml:"format"`
+	// SampleRate is the fraction of successful (< 400) requests to log,
+	// every request when unset and only errors when 0. Errors are always
+	// logged.
+	SampleRate *float64 `yaml:"sample_rate"`
+	// Output is "" to write through the application logger, "stdout",
+	// "stderr" or "file" for a separate access log.
+	Output string `yaml:"output"`
+	// File is rotated like the server log, as <dir>/<name>_<date>.log with
+	// the name "access" when empty
+	File logger.FileConfig `yaml:"file"`
+}
+
+const defaultAccessLogName = "access"
+
+type requestInfoKey string
+
+const requestInfoCtx requestInfoKey = "middleware.logging.requestInfo"
+
+// unmatchedRoute labels metrics of requests that did not reach a route
+const unmatchedRoute = "unmatched"
+
+const defaultMetricsService = "api"
+
+// requestInfo is filled in by inner handlers so the access log, which runs
+// outside of them, can report who made the request and which route served it
+type requestInfo struct {
+	mu      sync.Mutex
+	userID  string
+	route   string
+	traceID string
+}
+
+// setRequestUser records the authenticated user for the access log
+func setRequestUser(ctx context.Context, userID string) {
+	if info, ok := ctx.Value(requestInfoCtx).(*requestInfo); ok {
+		info.mu.Lock()
+		info.userID = userID
+		info.mu.Unlock()
+	}
+}
+
+// SetRoutePattern records the pattern of the route serving the request, e.g.
+// "/api/v1/users/{id}", which the HTTP metrics use instead of the raw path
+func SetRoutePattern(ctx context.Context, pattern string) {
+	if info, ok := ctx.Value(requestInfoCtx).(*requestInfo); ok {
+		info.mu.Lock()
+		info.route = pattern
+		info.mu.Unlock()
+	}
+}
+
+// setRequestTrace records the ID of a sampled trace for the latency exemplars
+func setRequestTrace(ctx context.Context, traceID string) {
+	if info, ok := ctx.Value(requestInfoCtx).(*requestInfo); ok {
+		info.mu.Lock()
+		info.traceID = traceID
+		info.mu.Unlock()
+	}
+}
+
+func (i *requestInfo) trace() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.traceID
+}
+
+func (i *requestInfo) user() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.userID
+}
+
+func (i *requestInfo) routePattern() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.route == "" {
+		return unmatchedRoute
+	}
+	return i.route
+}
+
+// accessLogEntry holds the fields available to every access log format
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remote_addr"`
+	UserID     string    `json:"user_id,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs float64   `json:"duration_ms"`
+	TTFBMs     float64   `json:"ttfb_ms"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+type accessLogger struct {
+	service    string
+	format     string
+	sampleRate float64
+	mu         sync.Mutex
+	out        io.Writer // nil writes through the application logger
+}
+
+var defaultAccessLogger = &accessLogger{service: defaultMetricsService, format: AccessLogDefault, sampleRate: 1}
+
+// NewAccessLog returns a logging middleware using the configured format,
+// sampling and output
+func NewAccessLog(config *AccessLogConfig) (Middleware, error) {
+	if config == nil {
+		return Logging, nil
+	}
+
+	l := &accessLogger{service: config.Service, format: config.Format, sampleRate: 1}
+	if l.service == "" {
+		l.service = defaultMetricsService
+	}
+	switch l.format {
+	case "":
+		l.format = AccessLogDefault
+	case AccessLogDefault, AccessLogCommon, AccessLogCombined, AccessLogJSON:
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", config.Format)
+	}
+	if config.SampleRate != nil {
+		l.sampleRate = *config.SampleRate
+	}
+	if l.sampleRate < 0 || l.sampleRate > 1 {
+		return nil, fmt.Errorf("access log sample rate must be between 0 and 1, got %v", l.sampleRate)
+	}
+
+	switch config.Output {
+	case "":
+	case "stdout":
+		l.out = os.Stdout
+	case "stderr":
+		l.out = os.Stderr
+	case "file":
+		fileConfig := config.File
+		if fileConfig.Name == "" {
+			fileConfig.Name = defaultAccessLogName
+		}
+		file, err := logger.NewRotatingFile(&fileConfig)
+		if err != nil {
+			return nil, fmt.Errorf("opening access log: %w", err)
+		}
+		l.out = file
+	default:
+		return nil, fmt.Errorf("unknown access log output %q", config.Output)
+	}
+
+	return l.middleware, nil
 }
 
+// Logging logs every request in the default format through the application logger
 func Logging(next http.Handler) http.Handler {
+	return defaultAccessLogger.middleware(next)
+}
+
+func (l *accessLogger) middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		inFlight := monitoring.HttpRequestsInFlight.WithLabelValues(l.service)
+		inFlight.Inc()
+		defer inFlight.Dec()
 
+		info := &requestInfo{}
 		ctx := context.WithValue(r.Context(), ReqStartTime, start)
+		ctx = context.WithValue(ctx, requestInfoCtx, info)
 		req := r.WithContext(ctx)
-		wrapped := &wrappedWriter{
-			ResponseWriter: w,
-			statusCode:     http.StatusOK,
+		body := &countingReader{ReadCloser: req.Body}
+		if req.Body != nil && req.Body != http.NoBody {
+			req.Body = body
 		}
+		wrapped := NewResponseRecorder(w)
 
 		next.ServeHTTP(wrapped, req)
 
 		duration := time.Since(start)
-		if wrapped.statusCode > 499 {
-			logger.Error("%d %s %s %v", wrapped.statusCode, req.Method, req.URL.Path, duration)
-			monitoring.HttpRequestErrorsTotal.WithLabelValues("api", req.Method, req.URL.Path, http.StatusText(wrapped.statusCode)).Inc()
-		} else {
-			logger.Info("%d %s %s %v", wrapped.statusCode, req.Method, req.URL.Path, duration)
+		l.observe(req, info.routePattern(), info.trace(), wrapped, body.n, duration)
+
+		if wrapped.Status() < 400 && l.sampleRate < 1 && rand.Float64() >= l.sampleRate {
+			return
 		}
 
-		monitoring.HttpRequestsTotal.WithLabelValues("api", req.Method, req.URL.Path).Inc()
-		monitoring.HttpRequestDuration.WithLabelValues("api", req.Method, req.URL.Path).Observe(time.Since(start).Seconds())
+		l.log(&accessLogEntry{
+			Time:       start,
+			RemoteAddr: ClientIP(req),
+			UserID:     info.user(),
+			RequestID:  GetRequestID(req.Context()),
+			Method:     req.Method,
+			Path:       req.URL.RequestURI(),
+			Proto:      req.Proto,
+			Status:     wrapped.Status(),
+			Bytes:      wrapped.BytesWritten(),
+			DurationMs: float64(duration.Microseconds()) / 1000,
+			TTFBMs:     float64(wrapped.TimeToFirstByte().Microseconds()) / 1000,
+			Referer:    req.Referer(),
+			UserAgent:  req.UserAgent(),
+		}, duration, wrapped.TimeToFirstByte())
 	})
 }
+
+// observe records the HTTP metrics, labelled by route pattern rather than
+// path to keep the number of series bounded. With a trace ID, the latency
+// links to the trace through an exemplar.
+func (l *accessLogger) observe(req *http.Request, route, traceID string, wrapped *ResponseRecorder, bodyRead int64, duration time.Duration) {
+	status := wrapped.Status()
+	statusClass := monitoring.StatusClass(status)
+	if status > 499 {
+		monitoring.HttpRequestErrorsTotal.WithLabelValues(l.service, req.Method, route, http.StatusText(status)).Inc()
+	}
+	monitoring.HttpRequestsTotal.WithLabelValues(l.service, req.Method, route, statusClass).Inc()
+	latency := monitoring.HttpRequestDuration.WithLabelValues(l.service, req.Method, route, statusClass)
+	if observer, ok := latency.(prometheus.ExemplarObserver); ok && traceID != "" {
+		observer.ObserveWithExemplar(duration.Seconds(), prometheus.Labels{"trace_id": traceID})
+	} else {
+		latency.Observe(duration.Seconds())
+	}
+
+	requestSize := req.ContentLength
+	if requestSize < 0 {
+		requestSize = bodyRead
+	}
+	monitoring.HttpRequestSize.WithLabelValues(l.service, req.Method, route).Observe(float64(requestSize))
+	monitoring.HttpResponseSize.WithLabelValues(l.service, req.Method, route).Observe(float64(wrapped.BytesWritten()))
+	if wrapped.WroteHeader() {
+		monitoring.HttpTimeToFirstByte.WithLabelValues(l.service, req.Method, route).Observe(wrapped.TimeToFirstByte().Seconds())
+	}
+}
+
+// countingReader counts the request body bytes read by handlers, for
+// requests without a Content-Length
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (l *accessLogger) log(entry *accessLogEntry, duration, ttfb time.Duration) {
+	var line string
+	switch l.format {
+	case AccessLogCommon:
+		line = commonLogLine(entry)
+	case AccessLogCombined:
+		line = commonLogLine(entry) + " " + strconv.Quote(entry.Referer) + " " + strconv.Quote(entry.UserAgent)
+	case AccessLogJSON:
+		data, err := json.Marshal(entry)
+		if err != nil {
+			logger.Error("Error marshalling access log entry: %v", err)
+			return
+		}
+		line = string(data)
+	default:
+		line = fmt.Sprintf("%d %s %s %v %dB ttfb=%v", entry.Status, entry.Method, entry.Path, duration, entry.Bytes, ttfb)
+	}
+
+	if l.out == nil {
+		if entry.Status > 499 {
+			logger.Error("%s", line)
+		} else {
+			logger.Info("%s", line)
+		}
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.out, line+"\n")
+}
+
+// commonLogLine formats host ident authuser [date] "request" status bytes
+func commonLogLine(entry *accessLogEntry) string {
+	user := entry.UserID
+	if user == "" {
+		user = "-"
+	}
+	size := "-"
+	if entry.Bytes > 0 {
+		size = strconv.FormatInt(entry.Bytes, 10)
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s",
+		entry.RemoteAddr,
+		user,
+		entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		entry.Method,
+		entry.Path,
+		entry.Proto,
+		entry.Status,
+		size,
+	)
+}
+
+// remoteHost strips the port from the request's remote address
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -6,9 +6,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/NhyiraAmofaSekyi/go-webserver/internal/logger"
 )
@@ -127,3 +129,126 @@ func TestLogging(t *testing.T) {
 	}
 
 }
+
+func TestAccessLogFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		expected []string
+	}{
+		{
+			name:   "Common Log Format",
+			format: AccessLogCommon,
+			expected: []string{
+				"192.0.2.1 - - [",
+				`"GET /test?q=1 HTTP/1.1" 200 5`,
+			},
+		},
+		{
+			name:   "Combined Log Format",
+			format: AccessLogCombined,
+			expected: []string{
+				`"GET /test?q=1 HTTP/1.1" 200 5 "http://example.com/" "test-agent"`,
+			},
+		},
+		{
+			name:   "JSON",
+			format: AccessLogJSON,
+			expected: []string{
+				`"remote_addr":"192.0.2.1"`,
+				`"request_id":"req-123"`,
+				`"status":200`,
+				`"bytes":5`,
+				`"referer":"http://example.com/"`,
+				`"user_agent":"test-agent"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			accessLog, err := NewAccessLog(&AccessLogConfig{Format: tt.format, Output: "file", File: logger.FileConfig{Dir: dir}})
+			if err != nil {
+				t.Fatalf("NewAccessLog returned error: %v", err)
+			}
+
+			handler := CreateStack(RequestID, accessLog)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("hello"))
+			}))
+
+			req := httptest.NewRequest("GET", "/test?q=1", nil)
+			req.Header.Set("Referer", "http://example.com/")
+			req.Header.Set("User-Agent", "test-agent")
+			req.Header.Set(RequestIDHeader, "req-123")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if got := rr.Header().Get(RequestIDHeader); got != "req-123" {
+				t.Errorf("request ID was not echoed: got %q", got)
+			}
+
+			content := readAccessLog(t, dir)
+			for _, expected := range tt.expected {
+				if !strings.Contains(string(content), expected) {
+					t.Errorf("access log does not contain %q\nLog output: %s", expected, content)
+				}
+			}
+		})
+	}
+}
+
+// readAccessLog returns today's access log written to dir
+func readAccessLog(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "access_"+time.Now().Format("2006-01-02")+".log")
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read access log: %v", err)
+	}
+	return string(content)
+}
+
+func TestAccessLogUserAndSampling(t *testing.T) {
+	dir := t.TempDir()
+	// Only errors are logged
+	sampleRate := 0.0
+	accessLog, err := NewAccessLog(&AccessLogConfig{Format: AccessLogJSON, SampleRate: &sampleRate, Output: "file", File: logger.FileConfig{Dir: dir}})
+	if err != nil {
+		t.Fatalf("NewAccessLog returned error: %v", err)
+	}
+
+	handler := accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setRequestUser(r.Context(), "kofi")
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, path := range []string{"/ok", "/error"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	logOutput := readAccessLog(t, dir)
+	if strings.Contains(logOutput, `"path":"/ok"`) {
+		t.Errorf("sampled out request was logged: %s", logOutput)
+	}
+	if !strings.Contains(logOutput, `"path":"/error"`) || !strings.Contains(logOutput, `"user_id":"kofi"`) {
+		t.Errorf("error request was not logged with user: %s", logOutput)
+	}
+}
+
+func TestNewAccessLogInvalidConfig(t *testing.T) {
+	if _, err := NewAccessLog(&AccessLogConfig{Format: "xml"}); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+	sampleRate := 2.0
+	if _, err := NewAccessLog(&AccessLogConfig{SampleRate: &sampleRate}); err == nil {
+		t.Error("Expected error for sample rate above 1")
+	}
+	if _, err := NewAccessLog(&AccessLogConfig{Output: "logs/access.log"}); err == nil {
+		t.Error("Expected error for unknown output")
+	}
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/utils"
+)
+
+const defaultMaintenanceMessage = "service is under maintenance"
+
+type MaintenanceConfig struct {
+	Enabled    bool          `yaml:"enabled"`     // start in maintenance mode
+	RetryAfter time.Duration `yaml:"retry_after"` // sent as Retry-After, rounded to seconds
+	Message    string        `yaml:"message"`
+	// Allowlist holds paths that keep being served, an entry ending in "/"
+	// matches every path below it
+	Allowlist []string `yaml:"allowlist"`
+}
+
+// MaintenanceState is the current maintenance mode as reported to admins
+type MaintenanceState struct {
+	Enabled bool      `json:"enabled"`
+	Message string    `json:"message"`
+	Since   time.Time `json:"since,omitempty"`
+}
+
+// maintenanceResponse is the error envelope with the maintenance details
+type maintenanceResponse struct {
+	utils.ErrorResponse
+	Maintenance bool `json:"maintenance"`
+	RetryAfter  int  `json:"retry_after,omitempty"` // seconds, as in Retry-After
+}
+
+// Maintenance is a runtime switch that makes the API answer 503 for every
+// route outside the allowlist. While enabled, responses carry
+// "Connection: close" so keep-alive connections drain away from this instance.
+type Maintenance struct {
+	mu         sync.RWMutex
+	state      MaintenanceState
+	retryAfter int
+	allowlist  []string
+	onChange   []func(MaintenanceState)
+}
+
+func NewMaintenance(config *MaintenanceConfig) *Maintenance {
+	m := &Maintenance{}
+	if config == nil {
+		config = &MaintenanceConfig{}
+	}
+	m.state.Message = config.Message
+	if m.state.Message == "" {
+		m.state.Message = defaultMaintenanceMessage
+	}
+	if config.RetryAfter > 0 {
+		m.retryAfter = int(config.RetryAfter.Round(time.Second).Seconds())
+	}
+	m.allowlist = config.Allowlist
+	if config.Enabled {
+		m.state.Enabled = true
+		m.state.Since = time.Now()
+	}
+	return m
+}
+
+// OnChange registers a callback run after every state change
+func (m *Maintenance) OnChange(fn func(MaintenanceState)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onChange = append(m.onChange, fn)
+}
+
+// State returns the current maintenance state
+func (m *Maintenance) State() MaintenanceState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// Enabled reports whether maintenance mode is on
+func (m *Maintenance) Enabled() bool {
+	return m.State().Enabled
+}
+
+// Set switches maintenance mode, an empty message keeps the current one
+func (m *Maintenance) Set(enabled bool, message string) MaintenanceState {
+	m.mu.Lock()
+	if enabled && !m.state.Enabled {
+		m.state.Since = time.Now()
+	}
+	if !enabled {
+		m.state.Since = time.Time{}
+	}
+	m.state.Enabled = enabled
+	if message != "" {
+		m.state.Message = message
+	}
+	state := m.state
+	callbacks := m.onChange
+	m.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(state)
+	}
+	return state
+}
+
+// Toggle flips maintenance mode and returns the new state
+func (m *Maintenance) Toggle() MaintenanceState {
+	return m.Set(!m.Enabled(), "")
+}
+
+func (m *Maintenance) allowed(path string) bool {
+	for _, entry := range m.allowlist {
+		if path == entry || (strings.HasSuffix(entry, "/") && strings.HasPrefix(path, entry)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware rejects requests with 503 while maintenance mode is enabled
+func (m *Maintenance) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := m.State()
+		if !state.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Connection", "close")
+		if m.allowed(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if m.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(m.retryAfter))
+		}
+		utils.RespondWithJSON(w, http.StatusServiceUnavailable, maintenanceResponse{
+			ErrorResponse: utils.ErrorResponse{
+				Error:     state.Message,
+				Code:      utils.ErrCodeUnavailable,
+				RequestID: GetRequestID(r.Context()),
+			},
+			Maintenance: true,
+			RetryAfter:  m.retryAfter,
+		})
+	})
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMaintenance(t *testing.T) {
+	m := NewMaintenance(&MaintenanceConfig{
+		RetryAfter: 2 * time.Minute,
+		Allowlist:  []string{"/metrics", "/api/v1/admin/"},
+	})
+
+	var changes []bool
+	m.OnChange(func(state MaintenanceState) {
+		changes = append(changes, state.Enabled)
+	})
+
+	handler := RequestID(m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name               string
+		enabled            bool
+		path               string
+		expectedStatus     int
+		expectedRetryAfter string
+	}{
+		{
+			name:           "Disabled",
+			enabled:        false,
+			path:           "/api/v1/users/createUser",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:               "Enabled Blocks Route",
+			enabled:            true,
+			path:               "/api/v1/users/createUser",
+			expectedStatus:     http.StatusServiceUnavailable,
+			expectedRetryAfter: "120",
+		},
+		{
+			name:           "Enabled Allows Exact Path",
+			enabled:        true,
+			path:           "/metrics",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Enabled Allows Prefix",
+			enabled:        true,
+			path:           "/api/v1/admin/maintenance",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:               "Enabled Does Not Match Partial Path",
+			enabled:            true,
+			path:               "/metricsfoo",
+			expectedStatus:     http.StatusServiceUnavailable,
+			expectedRetryAfter: "120",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m.Set(tt.enabled, "")
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if got := rr.Header().Get("Retry-After"); got != tt.expectedRetryAfter {
+				t.Errorf("wrong Retry-After header: got %q want %q", got, tt.expectedRetryAfter)
+			}
+			if tt.enabled && rr.Header().Get("Connection") != "close" {
+				t.Error("Connection: close not set during maintenance")
+			}
+			if rr.Code == http.StatusServiceUnavailable {
+				var body map[string]interface{}
+				if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+					t.Fatalf("Could not decode response body: %v", err)
+				}
+				if body["error"] != defaultMaintenanceMessage || body["maintenance"] != true || body["retry_after"] != float64(120) {
+					t.Errorf("unexpected maintenance body: %v", body)
+				}
+				if body["request_id"] == nil || body["request_id"] != rr.Header().Get(RequestIDHeader) {
+					t.Errorf("wrong request_id: got %v want %v", body["request_id"], rr.Header().Get(RequestIDHeader))
+				}
+			}
+		})
+	}
+
+	if len(changes) != len(tests) {
+		t.Errorf("OnChange called %d times, want %d", len(changes), len(tests))
+	}
+	if state := m.Toggle(); state.Enabled {
+		t.Error("Toggle did not disable maintenance mode")
+	}
+}
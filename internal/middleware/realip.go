@@ -0,0 +1,198 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/utils"
+)
+
+type ClientIPKey string
+
+const ClientIPCtx ClientIPKey = "middleware.realip.clientIP"
+
+type RealIPConfig struct {
+	// TrustedProxies lists the CIDRs (or single IPs) of proxies whose
+	// forwarding header is believed
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// Header is the one the trusted proxies write, "x-forwarded-for" (the
+	// default) or "forwarded". The other is ignored, a proxy passes it
+	// through from the client untouched.
+	Header string `yaml:"header"`
+}
+
+// Forwarding headers RealIPConfig.Header can name
+const (
+	HeaderXForwardedFor = "x-forwarded-for"
+	HeaderForwarded     = "forwarded"
+)
+
+type IPFilterConfig struct {
+	Allow []string `yaml:"allow"` // when set, only these CIDRs are let through
+	Deny  []string `yaml:"deny"`  // checked before Allow
+}
+
+// parsePrefixes accepts CIDRs as well as bare IP addresses
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHostAddr parses an address that may carry a port and IPv6 brackets
+func parseHostAddr(value string) (netip.Addr, bool) {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// forwardedChain returns the client addresses recorded by proxies in header,
+// from the original client to the closest proxy. Unparseable entries are
+// kept as invalid addresses.
+func forwardedChain(r *http.Request, header string) []netip.Addr {
+	var chain []netip.Addr
+	if header == HeaderForwarded {
+		for _, element := range strings.Split(strings.Join(r.Header.Values("Forwarded"), ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					addr, _ := parseHostAddr(value)
+					chain = append(chain, addr)
+				}
+			}
+		}
+		return chain
+	}
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			addr, _ := parseHostAddr(hop)
+			chain = append(chain, addr)
+		}
+	}
+	return chain
+}
+
+// resolveClientIP walks the forwarded chain from the closest hop outwards and
+// returns the first address that is not a trusted proxy
+func resolveClientIP(r *http.Request, trusted []netip.Prefix, header string) string {
+	remote, ok := parseHostAddr(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !containsAddr(trusted, remote) {
+		return remote.String()
+	}
+
+	client := remote
+	chain := forwardedChain(r, header)
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !chain[i].IsValid() {
+			// Obfuscated or malformed hop, the last trusted proxy is as far as we can see
+			break
+		}
+		client = chain[i]
+		if !containsAddr(trusted, client) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// NewRealIP returns a middleware that stores the real client IP in the
+// request context, trusting forwarding headers only from the given proxies
+func NewRealIP(config *RealIPConfig) (Middleware, error) {
+	var trusted []netip.Prefix
+	header := HeaderXForwardedFor
+	if config != nil {
+		var err error
+		if trusted, err = parsePrefixes(config.TrustedProxies); err != nil {
+			return nil, fmt.Errorf("trusted proxies: %w", err)
+		}
+		switch strings.ToLower(config.Header) {
+		case "", HeaderXForwardedFor:
+		case HeaderForwarded:
+			header = HeaderForwarded
+		default:
+			return nil, fmt.Errorf("unknown forwarding header %q, expected %s or %s", config.Header, HeaderXForwardedFor, HeaderForwarded)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), ClientIPCtx, resolveClientIP(r, trusted, header))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}, nil
+}
+
+// ClientIP returns the address resolved by the RealIP middleware, or the
+// host part of RemoteAddr when the middleware is not installed
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(ClientIPCtx).(string); ok {
+		return ip
+	}
+	return remoteHost(r)
+}
+
+// NewIPFilter returns a middleware that rejects clients on the deny list or,
+// when an allow list is configured, clients not on it
+func NewIPFilter(config *IPFilterConfig) (Middleware, error) {
+	if config == nil {
+		config = &IPFilterConfig{}
+	}
+	allow, err := parsePrefixes(config.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("allow list: %w", err)
+	}
+	deny, err := parsePrefixes(config.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("deny list: %w", err)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr, ok := parseHostAddr(ClientIP(r))
+			if !ok || containsAddr(deny, addr) || (len(allow) > 0 && !containsAddr(allow, addr)) {
+				utils.RespondWithError(w, http.StatusForbidden, "forbidden")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		headers    map[string]string
+		expectedIP string
+	}{
+		{
+			name:       "Direct Client",
+			remoteAddr: "203.0.113.5:1234",
+			expectedIP: "203.0.113.5",
+		},
+		{
+			name:       "Untrusted Client Spoofing Header",
+			remoteAddr: "203.0.113.5:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4"},
+			expectedIP: "203.0.113.5",
+		},
+		{
+			name:       "Trusted Proxy",
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.7"},
+			expectedIP: "198.51.100.7",
+		},
+		{
+			name:       "Spoofed Entry Before Real Client",
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7, 10.9.9.9"},
+			expectedIP: "198.51.100.7",
+		},
+		{
+			name:       "Single Trusted IP",
+			remoteAddr: "192.0.2.10:80",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.7"},
+			expectedIP: "198.51.100.7",
+		},
+		{
+			name:       "Forwarded Header With IPv6",
+			header:     HeaderForwarded,
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string]string{"Forwarded": `for="[2001:db8::1]:4711";proto=https, for=10.2.2.2`},
+			expectedIP: "2001:db8::1",
+		},
+		{
+			// The proxy appends to X-Forwarded-For and passes the client's Forwarded through
+			name:       "Forged Forwarded Is Ignored",
+			remoteAddr: "10.1.2.3:1234",
+			headers: map[string]string{
+				"Forwarded":       "for=10.0.0.1",
+				"X-Forwarded-For": "198.51.100.9",
+			},
+			expectedIP: "198.51.100.9",
+		},
+		{
+			name:       "Forged X-Forwarded-For Is Ignored",
+			header:     HeaderForwarded,
+			remoteAddr: "10.1.2.3:1234",
+			headers: map[string]string{
+				"Forwarded":       "for=198.51.100.8",
+				"X-Forwarded-For": "10.0.0.1",
+			},
+			expectedIP: "198.51.100.8",
+		},
+		{
+			name:       "Obfuscated Hop",
+			header:     HeaderForwarded,
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string]string{"Forwarded": "for=198.51.100.8, for=_hidden"},
+			expectedIP: "10.1.2.3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			realIP, err := NewRealIP(&RealIPConfig{
+				TrustedProxies: []string{"10.0.0.0/8", "192.0.2.10"},
+				Header:         tt.header,
+			})
+			if err != nil {
+				t.Fatalf("NewRealIP returned error: %v", err)
+			}
+
+			var got string
+			handler := realIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r)
+			}))
+
+			req := httptest.NewRequest("GET", "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.expectedIP {
+				t.Errorf("wrong client IP: got %s want %s", got, tt.expectedIP)
+			}
+		})
+	}
+}
+
+func TestIPFilter(t *testing.T) {
+	filter, err := NewIPFilter(&IPFilterConfig{
+		Allow: []string{"10.0.0.0/8", "127.0.0.1"},
+		Deny:  []string{"10.6.6.0/24"},
+	})
+	if err != nil {
+		t.Fatalf("NewIPFilter returned error: %v", err)
+	}
+	handler := filter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		remoteAddr     string
+		expectedStatus int
+	}{
+		{remoteAddr: "10.1.2.3:1234", expectedStatus: http.StatusOK},
+		{remoteAddr: "127.0.0.1:1234", expectedStatus: http.StatusOK},
+		{remoteAddr: "10.6.6.6:1234", expectedStatus: http.StatusForbidden},
+		{remoteAddr: "203.0.113.5:1234", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remoteAddr, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			req.RemoteAddr = tt.remoteAddr
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestInvalidIPConfig(t *testing.T) {
+	if _, err := NewRealIP(&RealIPConfig{TrustedProxies: []string{"10.0.0.0/33"}}); err == nil {
+		t.Error("Expected error for invalid trusted proxy CIDR")
+	}
+	if _, err := NewRealIP(&RealIPConfig{Header: "x-real-ip"}); err == nil {
+		t.Error("Expected error for unknown forwarding header")
+	}
+	if _, err := NewIPFilter(&IPFilterConfig{Allow: []string{"not-an-ip"}}); err == nil {
+		t.Error("Expected error for invalid allow list entry")
+	}
+}
@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ResponseRecorder wraps an http.ResponseWriter and records the status code,
+// the number of body bytes written and the time to first byte.
+//
+// Unlike a plain embedded http.ResponseWriter it keeps the optional
+// http.Flusher, http.Hijacker and io.ReaderFrom interfaces available to
+// handlers, and exposes Unwrap so http.ResponseController can reach the
+// underlying writer for deadlines and full duplex.
+type ResponseRecorder struct {
+	http.ResponseWriter
+	statusCode   int
+	wroteHeader  bool
+	hijacked     bool
+	bytesWritten int64
+	start        time.Time
+	firstByte    time.Time
+	capture      *bytes.Buffer
+	captureLimit int64
+	truncated    bool
+}
+
+var (
+	_ http.Flusher  = (*ResponseRecorder)(nil)
+	_ http.Hijacker = (*ResponseRecorder)(nil)
+	_ io.ReaderFrom = (*ResponseRecorder)(nil)
+)
+
+// NewResponseRecorder wraps w, measuring time to first byte from now
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	return &ResponseRecorder{
+		ResponseWriter: w,
+		statusCode:     http.StatusOK,
+		start:          time.Now(),
+	}
+}
+
+// markWritten records that the response headers have been sent
+func (rw *ResponseRecorder) markWritten(statusCode int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.wroteHeader = true
+	rw.statusCode = statusCode
+	rw.firstByte = time.Now()
+}
+
+func (rw *ResponseRecorder) WriteHeader(statusCode int) {
+	// Informational responses may be sent several times before the final one
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		rw.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if rw.wroteHeader {
+		return
+	}
+	rw.markWritten(statusCode)
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *ResponseRecorder) Write(b []byte) (int, error) {
+	rw.markWritten(http.StatusOK)
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytesWritten += int64(n)
+	if rw.capture != nil {
+		rw.captureBytes(b[:n])
+	}
+	return n, err
+}
+
+// captureBytes keeps a copy of written bytes up to the capture limit
+func (rw *ResponseRecorder) captureBytes(b []byte) {
+	remaining := rw.captureLimit - int64(rw.capture.Len())
+	if int64(len(b)) > remaining {
+		b = b[:remaining]
+		rw.truncated = true
+	}
+	rw.capture.Write(b)
+}
+
+// ReadFrom lets io.Copy use the underlying writer's ReadFrom (e.g. sendfile)
+func (rw *ResponseRecorder) ReadFrom(src io.Reader) (int64, error) {
+	rw.markWritten(http.StatusOK)
+	if rw.capture != nil {
+		// Go through Write so the body is captured and counted
+		return io.Copy(writerFunc(rw.Write), src)
+	}
+	var n int64
+	var err error
+	if rf, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(writerOnly{rw.ResponseWriter}, src)
+	}
+	rw.bytesWritten += n
+	return n, err
+}
+
+// Flush sends any buffered data to the client. It is a no-op when the
+// underlying writer cannot flush.
+func (rw *ResponseRecorder) Flush() {
+	_ = rw.FlushError()
+}
+
+// FlushError is used by http.ResponseController to report flush failures
+func (rw *ResponseRecorder) FlushError() error {
+	rw.markWritten(http.StatusOK)
+	return http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Hijack lets the caller take over the connection, as needed for WebSockets
+func (rw *ResponseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err == nil {
+		rw.hijacked = true
+		rw.markWritten(http.StatusSwitchingProtocols)
+	}
+	return conn, buf, err
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (rw *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// CaptureBody makes the recorder keep a copy of up to limit bytes of the
+// response body. It must be called before the handler writes anything.
+func (rw *ResponseRecorder) CaptureBody(limit int64) {
+	rw.capture = &bytes.Buffer{}
+	rw.captureLimit = limit
+}
+
+// Body returns the captured response body
+func (rw *ResponseRecorder) Body() []byte {
+	if rw.capture == nil {
+		return nil
+	}
+	return rw.capture.Bytes()
+}
+
+// BodyTruncated reports whether the response body exceeded the capture limit
+func (rw *ResponseRecorder) BodyTruncated() bool {
+	return rw.truncated
+}
+
+// Status returns the status code sent to the client, 200 if nothing was written yet
+func (rw *ResponseRecorder) Status() int {
+	return rw.statusCode
+}
+
+// WroteHeader reports whether the response headers have been sent
+func (rw *ResponseRecorder) WroteHeader() bool {
+	return rw.wroteHeader
+}
+
+// Hijacked reports whether the connection was taken over by the handler
+func (rw *ResponseRecorder) Hijacked() bool {
+	return rw.hijacked
+}
+
+// BytesWritten returns the number of response body bytes written
+func (rw *ResponseRecorder) BytesWritten() int64 {
+	return rw.bytesWritten
+}
+
+// TimeToFirstByte returns the time between creating the recorder and sending
+// the response headers, or 0 if nothing has been sent
+func (rw *ResponseRecorder) TimeToFirstByte() time.Duration {
+	if !rw.wroteHeader {
+		return 0
+	}
+	return rw.firstByte.Sub(rw.start)
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) {
+	return f(b)
+}
+
+// writerOnly hides optional interfaces so io.Copy doesn't recurse into ReadFrom
+type writerOnly struct {
+	io.Writer
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponseRecorder(t *testing.T) {
+	tests := []struct {
+		name          string
+		handler       http.HandlerFunc
+		expectedCode  int
+		expectedBytes int64
+	}{
+		{
+			name: "Implicit OK",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("hello"))
+			},
+			expectedCode:  http.StatusOK,
+			expectedBytes: 5,
+		},
+		{
+			name: "Explicit Status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("created"))
+			},
+			expectedCode:  http.StatusCreated,
+			expectedBytes: 7,
+		},
+		{
+			name: "Informational Before Final",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusEarlyHints)
+				w.WriteHeader(http.StatusAccepted)
+			},
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name: "ReadFrom",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(w, strings.NewReader("streamed body"))
+			},
+			expectedCode:  http.StatusOK,
+			expectedBytes: 13,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			rec := NewResponseRecorder(rr)
+
+			tt.handler(rec, httptest.NewRequest("GET", "/test", nil))
+
+			if rec.Status() != tt.expectedCode {
+				t.Errorf("wrong recorded status: got %d want %d", rec.Status(), tt.expectedCode)
+			}
+			if rec.BytesWritten() != tt.expectedBytes {
+				t.Errorf("wrong bytes written: got %d want %d", rec.BytesWritten(), tt.expectedBytes)
+			}
+			if rec.WroteHeader() && rec.TimeToFirstByte() < 0 {
+				t.Errorf("negative time to first byte: %v", rec.TimeToFirstByte())
+			}
+		})
+	}
+}
+
+func TestResponseRecorderOptionalInterfaces(t *testing.T) {
+	server := httptest.NewServer(Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stream":
+			if _, ok := w.(http.Flusher); !ok {
+				t.Error("response writer does not implement http.Flusher")
+			}
+			rc := http.NewResponseController(w)
+			if err := rc.SetWriteDeadline(time.Now().Add(time.Second)); err != nil {
+				t.Errorf("ResponseController could not set write deadline: %v", err)
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: one\n\n"))
+			if err := rc.Flush(); err != nil {
+				t.Errorf("ResponseController could not flush: %v", err)
+			}
+		case "/hijack":
+			hj, ok := w.(http.Hijacker)
+			if !ok {
+				t.Error("response writer does not implement http.Hijacker")
+				return
+			}
+			conn, buf, err := hj.Hijack()
+			if err != nil {
+				t.Errorf("hijack failed: %v", err)
+				return
+			}
+			defer conn.Close()
+			buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+			buf.Flush()
+		}
+	})))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stream")
+	if err != nil {
+		t.Fatalf("stream request failed: %v", err)
+	}
+	line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+	resp.Body.Close()
+	if line != "data: one\n" {
+		t.Errorf("unexpected stream body: %q", line)
+	}
+
+	resp, err = http.Get(server.URL + "/hijack")
+	if err != nil {
+		t.Fatalf("hijack request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hijacked" {
+		t.Errorf("unexpected hijacked body: %q", body)
+	}
+}
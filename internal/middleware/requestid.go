@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/logger"
+)
+
+type RequestIDKey string
+
+const RequestIDCtx RequestIDKey = "middleware.requestID"
+
+const (
+	RequestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 128
+)
+
+// validRequestID accepts client supplied IDs made of printable, header safe characters
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID reuses a valid incoming X-Request-ID header or generates a new
+// one, echoes it on the response and stores it in the request context,
+// where the logger's context helpers pick it up.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), RequestIDCtx, id)
+		ctx = logger.WithAttrs(ctx, "request_id", id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetRequestID returns the ID assigned by RequestID, or "" if there is none
+func GetRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(RequestIDCtx).(string)
+	return id
+}
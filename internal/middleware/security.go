@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/logger"
+)
+
+type CSPNonceKey string
+
+const CSPNonceCtx CSPNonceKey = "middleware.security.cspNonce"
+
+// NoncePlaceholder is replaced with the per-request nonce in ContentSecurityPolicy
+const NoncePlaceholder = "{nonce}"
+
+type SecurityHeadersConfig struct {
+	HSTSMaxAge            int    `yaml:"hsts_max_age"` // seconds, negative disables HSTS
+	HSTSIncludeSubdomains bool   `yaml:"hsts_include_subdomains"`
+	HSTSPreload           bool   `yaml:"hsts_preload"`
+	ContentTypeOptions    string `yaml:"content_type_options"`
+	FrameOptions          string `yaml:"frame_options"`
+	ReferrerPolicy        string `yaml:"referrer_policy"`
+	ContentSecurityPolicy string `yaml:"content_security_policy"`
+}
+
+var DefaultSecurityHeadersConfig = &SecurityHeadersConfig{
+	HSTSMaxAge:            63072000,
+	HSTSIncludeSubdomains: true,
+	ContentTypeOptions:    "nosniff",
+	FrameOptions:          "DENY",
+	ReferrerPolicy:        "strict-origin-when-cross-origin",
+	ContentSecurityPolicy: "default-src 'self'; script-src 'self' 'nonce-{nonce}'; style-src 'self' 'nonce-{nonce}'; frame-ancestors 'none'; base-uri 'self'",
+}
+
+// withDefaults fills the fields left empty in config from
+// DefaultSecurityHeadersConfig. The HSTS flags are only defaulted along with
+// the max age, since false cannot be told apart from unset.
+func (c *SecurityHeadersConfig) withDefaults() *SecurityHeadersConfig {
+	// Create new config to avoid modifying the input
+	validConfig := *c
+
+	if validConfig.HSTSMaxAge == 0 {
+		validConfig.HSTSMaxAge = DefaultSecurityHeadersConfig.HSTSMaxAge
+		validConfig.HSTSIncludeSubdomains = DefaultSecurityHeadersConfig.HSTSIncludeSubdomains
+		validConfig.HSTSPreload = DefaultSecurityHeadersConfig.HSTSPreload
+	}
+	if validConfig.ContentTypeOptions == "" {
+		validConfig.ContentTypeOptions = DefaultSecurityHeadersConfig.ContentTypeOptions
+	}
+	if validConfig.FrameOptions == "" {
+		validConfig.FrameOptions = DefaultSecurityHeadersConfig.FrameOptions
+	}
+	if validConfig.ReferrerPolicy == "" {
+		validConfig.ReferrerPolicy = DefaultSecurityHeadersConfig.ReferrerPolicy
+	}
+	if validConfig.ContentSecurityPolicy == "" {
+		validConfig.ContentSecurityPolicy = DefaultSecurityHeadersConfig.ContentSecurityPolicy
+	}
+
+	return &validConfig
+}
+
+// hstsValue builds the Strict-Transport-Security header value
+func (c *SecurityHeadersConfig) hstsValue() string {
+	if c.HSTSMaxAge <= 0 {
+		return ""
+	}
+	value := "max-age=" + strconv.Itoa(c.HSTSMaxAge)
+	if c.HSTSIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if c.HSTSPreload {
+		value += "; preload"
+	}
+	return value
+}
+
+// generateNonce returns a random base64 encoded value suitable for a CSP nonce
+func generateNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// CSPNonce returns the nonce generated for the current request, or "" if none was set
+func CSPNonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(CSPNonceCtx).(string)
+	return nonce
+}
+
+// SecurityHeaders returns a middleware that sets the configured security headers.
+// A fresh nonce is generated for every request and stored in the request context
+// so templates can reference it via CSPNonce. Fields left empty use the
+// value from DefaultSecurityHeadersConfig.
+func SecurityHeaders(config *SecurityHeadersConfig) Middleware {
+	if config == nil {
+		config = DefaultSecurityHeadersConfig
+	}
+	config = config.withDefaults()
+	hsts := config.hstsValue()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := w.Header()
+
+			if hsts != "" {
+				header.Set("Strict-Transport-Security", hsts)
+			}
+			if config.ContentTypeOptions != "" {
+				header.Set("X-Content-Type-Options", config.ContentTypeOptions)
+			}
+			if config.FrameOptions != "" {
+				header.Set("X-Frame-Options", config.FrameOptions)
+			}
+			if config.ReferrerPolicy != "" {
+				header.Set("Referrer-Policy", config.ReferrerPolicy)
+			}
+
+			if config.ContentSecurityPolicy != "" {
+				nonce, err := generateNonce()
+				if err != nil {
+					logger.Error("Failed to generate CSP nonce: %v", err)
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+				header.Set("Content-Security-Policy", strings.ReplaceAll(config.ContentSecurityPolicy, NoncePlaceholder, nonce))
+				r = r.WithContext(context.WithValue(r.Context(), CSPNonceCtx, nonce))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          *SecurityHeadersConfig
+		expectedHeaders map[string]string
+		absentHeaders   []string
+	}{
+		{
+			name:   "Default Config",
+			config: nil,
+			expectedHeaders: map[string]string{
+				"Strict-Transport-Security": "max-age=63072000; includeSubDomains",
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "DENY",
+				"Referrer-Policy":           "strict-origin-when-cross-origin",
+			},
+		},
+		{
+			name:   "Empty Config",
+			config: &SecurityHeadersConfig{},
+			expectedHeaders: map[string]string{
+				"Strict-Transport-Security": "max-age=63072000; includeSubDomains",
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "DENY",
+				"Referrer-Policy":           "strict-origin-when-cross-origin",
+			},
+		},
+		{
+			name: "Partial Config",
+			config: &SecurityHeadersConfig{
+				FrameOptions: "SAMEORIGIN",
+			},
+			expectedHeaders: map[string]string{
+				"Strict-Transport-Security": "max-age=63072000; includeSubDomains",
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "SAMEORIGIN",
+				"Referrer-Policy":           "strict-origin-when-cross-origin",
+			},
+		},
+		{
+			name: "HSTS Disabled",
+			config: &SecurityHeadersConfig{
+				HSTSMaxAge:         -1,
+				ContentTypeOptions: "nosniff",
+				FrameOptions:       "SAMEORIGIN",
+			},
+			expectedHeaders: map[string]string{
+				"X-Content-Type-Options": "nosniff",
+				"X-Frame-Options":        "SAMEORIGIN",
+				"Referrer-Policy":        "strict-origin-when-cross-origin",
+			},
+			absentHeaders: []string{"Strict-Transport-Security"},
+		},
+		{
+			name: "HSTS With Preload",
+			config: &SecurityHeadersConfig{
+				HSTSMaxAge:  300,
+				HSTSPreload: true,
+			},
+			expectedHeaders: map[string]string{
+				"Strict-Transport-Security": "max-age=300; preload",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", "/test", nil)
+			rr := httptest.NewRecorder()
+
+			SecurityHeaders(tt.config)(handler).ServeHTTP(rr, req)
+
+			for key, expected := range tt.expectedHeaders {
+				if got := rr.Header().Get(key); got != expected {
+					t.Errorf("handler returned wrong header %s: got %v want %v", key, got, expected)
+				}
+			}
+			for _, key := range tt.absentHeaders {
+				if got := rr.Header().Get(key); got != "" {
+					t.Errorf("handler set unexpected header %s: %v", key, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersNonce(t *testing.T) {
+	var nonces []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonces = append(nonces, CSPNonce(r.Context()))
+	})
+	stack := SecurityHeaders(&SecurityHeadersConfig{
+		ContentSecurityPolicy: "script-src 'nonce-{nonce}'",
+	})(handler)
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		stack.ServeHTTP(rr, httptest.NewRequest("GET", "/test", nil))
+
+		nonce := nonces[i]
+		if nonce == "" {
+			t.Fatal("nonce was not added to the request context")
+		}
+		csp := rr.Header().Get("Content-Security-Policy")
+		if csp != "script-src 'nonce-"+nonce+"'" {
+			t.Errorf("CSP header does not contain the request nonce: %s", csp)
+		}
+		if strings.Contains(csp, NoncePlaceholder) {
+			t.Errorf("CSP header still contains placeholder: %s", csp)
+		}
+	}
+
+	if nonces[0] == nonces[1] {
+		t.Error("nonce was reused across requests")
+	}
+}
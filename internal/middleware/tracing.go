@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/NhyiraAmofaSekyi/go-webserver/internal/middleware"
+
+// Tracing starts a server span for every request, continuing the trace of
+// an incoming W3C traceparent header. The span is named after the matched
+// route, so it must run inside the access log which collects the route.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(tracerName).Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(ClientIP(r)),
+				semconv.UserAgentOriginal(r.UserAgent()),
+				attribute.String("http.request.id", GetRequestID(r.Context())),
+			),
+		)
+		defer span.End()
+		if span.SpanContext().IsSampled() {
+			setRequestTrace(ctx, span.SpanContext().TraceID().String())
+		}
+
+		wrapped := NewResponseRecorder(w)
+		next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+		if info, ok := ctx.Value(requestInfoCtx).(*requestInfo); ok {
+			if route := info.routePattern(); route != unmatchedRoute {
+				span.SetName(r.Method + " " + route)
+				span.SetAttributes(semconv.HTTPRoute(route))
+			}
+			if user := info.user(); user != "" {
+				span.SetAttributes(semconv.EnduserID(user))
+			}
+		}
+		status := wrapped.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/logger"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	accessLog, err := NewAccessLog(&AccessLogConfig{Service: "tracing-test", Output: "file", File: logger.FileConfig{Dir: t.TempDir()}})
+	if err != nil {
+		t.Fatalf("NewAccessLog returned error: %v", err)
+	}
+	handler := accessLog(Tracing(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetRoutePattern(r.Context(), "/users/{id}")
+		w.WriteHeader(http.StatusInternalServerError)
+	})))
+
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /users/{id}" {
+		t.Errorf("wrong span name: got %q want %q", span.Name(), "GET /users/{id}")
+	}
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("span did not continue the incoming trace: got trace ID %s", got)
+	}
+	if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("wrong parent span ID: got %s", got)
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("5xx response did not mark the span as failed: %v", span.Status())
+	}
+	if got := latencyExemplar(t, "tracing-test"); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("latency exemplar does not link to the trace: got trace_id %q", got)
+	}
+}
+
+// latencyExemplar returns the trace_id of the exemplar recorded on the
+// request latency histogram of service
+func latencyExemplar(t *testing.T, service string) string {
+	families, err := monitoring.Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "http_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			matches := false
+			for _, label := range metric.GetLabel() {
+				matches = matches || (label.GetName() == "service" && label.GetValue() == service)
+			}
+			if !matches {
+				continue
+			}
+			for _, bucket := range metric.GetHistogram().GetBucket() {
+				for _, label := range bucket.GetExemplar().GetLabel() {
+					if label.GetName() == "trace_id" {
+						return label.GetValue()
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
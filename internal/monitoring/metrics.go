@@ -1,7 +1,11 @@
 package monitoring
 
 import (
+	"database/sql"
+	"strconv"
+
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 var (
@@ -10,7 +14,7 @@ var (
 			Name: "http_requests_total",
 			Help: "Total number of HTTP requests",
 		},
-		[]string{"service", "method", "endpoint"},
+		[]string{"service", "method", "route", "status_class"},
 	)
 	HttpRequestDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -18,23 +22,255 @@ var (
 			Help:    "Histogram of response latencies",
 			Buckets: prometheus.DefBuckets,
 		},
-		[]string{"service", "method", "endpoint"},
+		[]string{"service", "method", "route", "status_class"},
 	)
 	HttpRequestErrorsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "http_request_errors_total",
 			Help: "Total number of HTTP request errors",
 		},
-		[]string{"service", "method", "endpoint", "error"},
+		[]string{"service", "method", "route", "error"},
+	)
+	HttpRequestsInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests currently being served",
+		},
+		[]string{"service"},
+	)
+	HttpRequestSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_size_bytes",
+			Help:    "Histogram of request body sizes",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 10), // 64B to 16MB
+		},
+		[]string{"service", "method", "route"},
+	)
+	HttpResponseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_response_size_bytes",
+			Help:    "Histogram of response body sizes",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 10), // 64B to 16MB
+		},
+		[]string{"service", "method", "route"},
+	)
+	HttpTimeToFirstByte = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_time_to_first_byte_seconds",
+			Help:    "Histogram of the time until the response headers were written",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"service", "method", "route"},
+	)
+	HttpCacheRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_cache_requests_total",
+			Help: "Total number of requests seen by the response cache by result (hit, miss, bypass)",
+		},
+		[]string{"cache", "result"},
+	)
+	HttpCacheEvictionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_cache_evictions_total",
+			Help: "Total number of response cache entries evicted to make room for new ones",
+		},
+		[]string{"cache"},
+	)
+	HttpCacheInvalidationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_cache_invalidations_total",
+			Help: "Total number of response cache entries removed by tag invalidation",
+		},
+		[]string{"cache"},
+	)
+	HttpConcurrencyInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "http_concurrency_in_flight",
+			Help: "Number of requests currently holding a concurrency limiter slot",
+		},
+		[]string{"limiter"},
+	)
+	HttpQueuedRequests = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "http_queued_requests",
+			Help: "Number of requests waiting for a concurrency limiter slot",
+		},
+		[]string{"limiter"},
+	)
+	HttpConcurrencyLimit = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "http_concurrency_limit",
+			Help: "Current concurrency limit, which moves when adaptive limiting is on",
+		},
+		[]string{"limiter"},
+	)
+	HttpShedRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_shed_requests_total",
+			Help: "Total number of requests rejected by load shedding by reason",
+		},
+		[]string{"limiter", "reason"},
+	)
+	DbQueryDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "db_query_duration_seconds",
+			Help:    "Histogram of database query durations by sqlc query name",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		},
+		[]string{"query"},
+	)
+	DbQueryErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "db_query_errors_total",
+			Help: "Total number of failed database queries by sqlc query name",
+		},
+		[]string{"query"},
+	)
+	AuthSignInsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_sign_ins_total",
+			Help: "Total number of sign-in attempts by outcome (success, invalid_request, invalid_credentials, error)",
+		},
+		[]string{"outcome"},
+	)
+	AuthTokenValidationFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_token_validation_failures_total",
+			Help: "Total number of requests whose bearer token was missing or rejected by reason",
+		},
+		[]string{"reason"},
+	)
+	EmailsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "emails_total",
+			Help: "Total number of emails by kind (text, html) and result (sent, failed)",
+		},
+		[]string{"kind", "result"},
+	)
+	EmailSendDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "email_send_duration_seconds",
+			Help:    "Histogram of SMTP send durations by kind and result",
+			Buckets: []float64{.1, .25, .5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"kind", "result"},
+	)
+	UploadsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "uploads_total",
+			Help: "Total number of file uploads by content type and result (success, failed)",
+		},
+		[]string{"content_type", "result"},
+	)
+	UploadBytesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "upload_bytes_total",
+			Help: "Total number of bytes uploaded successfully by content type",
+		},
+		[]string{"content_type"},
+	)
+	UsersCreatedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "users_created_total",
+			Help: "Total number of users created",
+		},
+	)
+	AuditEventsDroppedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "audit_events_dropped_total",
+			Help: "Total number of audit events dropped because the write queue was full or closed",
+		},
+	)
+	AuditWriteErrorsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "audit_write_errors_total",
+			Help: "Total number of audit events that could not be written to the database",
+		},
+	)
+	ErrorReportsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "error_reports_total",
+			Help: "Total number of errors reported by kind (panic, http_5xx, log), sent or not",
+		},
+		[]string{"kind"},
+	)
+	ErrorReportsDroppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "error_reports_dropped_total",
+			Help: "Total number of error reports not sent by reason (grouped, rate_limited, queue_full, closed)",
+		},
+		[]string{"reason"},
+	)
+	ErrorReportSinkErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "error_report_sink_errors_total",
+			Help: "Total number of error reports a sink failed to send by sink",
+		},
+		[]string{"sink"},
 	)
 )
 
 func init() {
 
-	prometheus.MustRegister(
+	Registry.MustRegister(
 		HttpRequestsTotal,
 		HttpRequestDuration,
 		HttpRequestErrorsTotal,
+		HttpRequestsInFlight,
+		HttpRequestSize,
+		HttpResponseSize,
+		HttpTimeToFirstByte,
+		HttpCacheRequestsTotal,
+		HttpCacheEvictionsTotal,
+		HttpCacheInvalidationsTotal,
+		HttpConcurrencyInFlight,
+		HttpQueuedRequests,
+		HttpConcurrencyLimit,
+		HttpShedRequestsTotal,
+		DbQueryDuration,
+		DbQueryErrorsTotal,
+		AuthSignInsTotal,
+		AuthTokenValidationFailuresTotal,
+		EmailsTotal,
+		EmailSendDuration,
+		UploadsTotal,
+		UploadBytesTotal,
+		UsersCreatedTotal,
+		AuditEventsDroppedTotal,
+		AuditWriteErrorsTotal,
+		ErrorReportsTotal,
+		ErrorReportsDroppedTotal,
+		ErrorReportSinkErrorsTotal,
 	)
 
+	// Export the domain series at zero so rates and alerts work before the
+	// first event
+	for _, outcome := range []string{"success", "invalid_request", "invalid_credentials", "error"} {
+		AuthSignInsTotal.WithLabelValues(outcome)
+	}
+	for _, reason := range TokenFailureReasons {
+		AuthTokenValidationFailuresTotal.WithLabelValues(reason)
+	}
+	for _, kind := range []string{"text", "html"} {
+		for _, result := range []string{"sent", "failed"} {
+			EmailsTotal.WithLabelValues(kind, result)
+		}
+	}
+}
+
+// TokenFailureReasons are the reason labels of auth_token_validation_failures_total
+var TokenFailureReasons = []string{"missing", "malformed_header", "malformed", "invalid_signature", "expired", "not_yet_valid", "missing_claims", "invalid"}
+
+// RegisterDBStats exports the connection pool stats of db: open, in use and
+// idle connections, and how often and how long callers waited for one
+func RegisterDBStats(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// StatusClass groups a status code for the status_class label, e.g. "2xx"
+func StatusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(code/100) + "xx"
 }
@@ -0,0 +1,125 @@
+package monitoring
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Registry holds every metric of the server, in place of the global
+// registry so libraries cannot add series behind our back
+var Registry = prometheus.NewRegistry()
+
+// Config of the /metrics endpoint
+type Config struct {
+	Namespace   string            `yaml:"namespace"`    // prefixed to the server's metric names, not go_ and process_ ones
+	ConstLabels map[string]string `yaml:"const_labels"` // added to every series, values expand environment variables
+	Addr        string            `yaml:"addr"`         // serve /metrics on its own listener, e.g. ":9090"
+	Username    string            `yaml:"username"`     // require basic auth, the password is read from METRICS_PASSWORD
+	Password    string            `yaml:"-"`
+	Token       string            `yaml:"-"` // require a bearer token, from METRICS_TOKEN
+}
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// exposition is what Configure set, read on every scrape
+type exposition struct {
+	prefix string
+	labels []*dto.LabelPair
+}
+
+var current atomic.Pointer[exposition]
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	current.Store(&exposition{})
+}
+
+// Configure sets the namespace and const labels added when metrics are
+// served. Metrics keep their plain names in Registry.
+func Configure(config *Config) error {
+	if config.Namespace != "" && !namePattern.MatchString(config.Namespace) {
+		return fmt.Errorf("invalid metrics namespace %q", config.Namespace)
+	}
+	if config.Username != "" && config.Token != "" {
+		return fmt.Errorf("metrics can be protected by basic auth or a bearer token, not both")
+	}
+	if config.Username != "" && config.Password == "" {
+		return fmt.Errorf("metrics username is set but METRICS_PASSWORD is empty")
+	}
+
+	e := &exposition{}
+	if config.Namespace != "" {
+		e.prefix = config.Namespace + "_"
+	}
+	for name, value := range config.ConstLabels {
+		if !namePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid metrics label name %q", name)
+		}
+		name, value := name, os.ExpandEnv(value)
+		e.labels = append(e.labels, &dto.LabelPair{Name: &name, Value: &value})
+	}
+	sort.Slice(e.labels, func(i, j int) bool { return e.labels[i].GetName() < e.labels[j].GetName() })
+	current.Store(e)
+	return nil
+}
+
+// Gather returns the metrics of Registry with the configured namespace and
+// const labels. A series that already has a const label keeps its own value.
+func Gather() ([]*dto.MetricFamily, error) {
+	families, err := Registry.Gather()
+	e := current.Load()
+	for _, family := range families {
+		if e.prefix != "" && !runtimeMetric(family.GetName()) {
+			name := e.prefix + family.GetName()
+			family.Name = &name
+		}
+		if len(e.labels) == 0 {
+			continue
+		}
+		for _, metric := range family.Metric {
+			metric.Label = withLabels(metric.Label, e.labels)
+		}
+	}
+	return families, err
+}
+
+func runtimeMetric(name string) bool {
+	return strings.HasPrefix(name, "go_") || strings.HasPrefix(name, "process_")
+}
+
+// withLabels merges the sorted extra labels into the sorted labels of a series
+func withLabels(labels, extra []*dto.LabelPair) []*dto.LabelPair {
+	merged := make([]*dto.LabelPair, 0, len(labels)+len(extra))
+	merged = append(merged, labels...)
+	for _, label := range extra {
+		i := sort.Search(len(merged), func(i int) bool { return merged[i].GetName() >= label.GetName() })
+		if i < len(merged) && merged[i].GetName() == label.GetName() {
+			continue
+		}
+		merged = append(merged, nil)
+		copy(merged[i+1:], merged[i:])
+		merged[i] = label
+	}
+	return merged
+}
+
+// Handler serves the metrics from Gather. Exemplars are only included when
+// the scraper asks for the OpenMetrics format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(prometheus.GathererFunc(Gather), promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+	})
+}
@@ -0,0 +1,73 @@
+package monitoring
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConfigure(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		expectError bool
+	}{
+		{name: "Empty", config: Config{}},
+		{name: "Namespace And Labels", config: Config{Namespace: "app", ConstLabels: map[string]string{"environment": "test"}}},
+		{name: "Invalid Namespace", config: Config{Namespace: "my-app"}, expectError: true},
+		{name: "Invalid Label", config: Config{ConstLabels: map[string]string{"__name__": "x"}}, expectError: true},
+		{name: "Basic Auth And Token", config: Config{Username: "ops", Password: "s3cret", Token: "t0ken"}, expectError: true},
+		{name: "Username Without Password", config: Config{Username: "ops"}, expectError: true},
+	}
+	defer Configure(&Config{})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Configure(&tt.config)
+			if (err != nil) != tt.expectError {
+				t.Errorf("Configure returned error %v, expected error: %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestHandlerNamespaceAndLabels(t *testing.T) {
+	t.Setenv("METRICS_TEST_INSTANCE", "web-1")
+	if err := Configure(&Config{
+		Namespace: "app",
+		ConstLabels: map[string]string{
+			"instance": "${METRICS_TEST_INSTANCE}",
+			// Series with their own service label keep it
+			"service": "web",
+		},
+	}); err != nil {
+		t.Fatalf("Configure returned error: %v", err)
+	}
+	defer Configure(&Config{})
+	HttpRequestsTotal.WithLabelValues("registry-test", "GET", "/", "2xx").Inc()
+
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	body := rr.Body.String()
+
+	tests := []struct {
+		name     string
+		contains string
+		expected bool
+	}{
+		{name: "Prefixed", contains: `app_http_requests_total{instance="web-1",method="GET",route="/",service="registry-test",status_class="2xx"} 1`, expected: true},
+		{name: "Unprefixed Name", contains: "\nhttp_requests_total{", expected: false},
+		{name: "Runtime Not Prefixed", contains: "\ngo_goroutines{instance=\"web-1\",service=\"web\"}", expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if strings.Contains(body, tt.contains) != tt.expected {
+				t.Errorf("body contains %q: got %v want %v", tt.contains, !tt.expected, tt.expected)
+			}
+		})
+	}
+}
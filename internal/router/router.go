@@ -0,0 +1,224 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/middleware"
+	"github.com/NhyiraAmofaSekyi/go-webserver/utils"
+)
+
+// registry is shared by a router and all of its groups
+type registry struct {
+	mux   *http.ServeMux
+	mu    sync.RWMutex
+	names map[string]*Route
+}
+
+// Router registers Go 1.22 ServeMux patterns under a path prefix with a
+// middleware stack. Groups share the underlying mux, so every route ends up
+// with its full path and r.PathValue works without StripPrefix.
+type Router struct {
+	reg         *registry
+	prefix      string
+	middlewares []middleware.Middleware
+}
+
+// Route is a registered pattern that can be named for URL building
+type Route struct {
+	reg     *registry
+	path    string
+	pattern string
+}
+
+// New returns an empty router
+func New() *Router {
+	return &Router{
+		reg: &registry{
+			mux:   http.NewServeMux(),
+			names: make(map[string]*Route),
+		},
+	}
+}
+
+// Use appends middleware to the router's stack. It only applies to routes
+// registered after the call, including those of groups created afterwards.
+func (r *Router) Use(middlewares ...middleware.Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// Group returns a router for routes below prefix that starts with a copy of
+// the current middleware stack. fn, if given, is called with the group.
+func (r *Router) Group(prefix string, fn ...func(*Router)) *Router {
+	group := &Router{
+		reg:         r.reg,
+		prefix:      joinPath(r.prefix, prefix),
+		middlewares: append([]middleware.Middleware(nil), r.middlewares...),
+	}
+	for _, f := range fn {
+		f(group)
+	}
+	return group
+}
+
+// With returns a group at the same prefix with additional middleware
+func (r *Router) With(middlewares ...middleware.Middleware) *Router {
+	group := r.Group("")
+	group.Use(middlewares...)
+	return group
+}
+
+// Handle registers handler for a "[METHOD ]/path" pattern relative to the
+// router's prefix, wrapped in the router's middleware stack
+func (r *Router) Handle(pattern string, handler http.Handler) *Route {
+	method, path := splitPattern(pattern)
+	route := &Route{
+		reg:  r.reg,
+		path: joinPath(r.prefix, path),
+	}
+	route.pattern = route.path
+	if method != "" {
+		route.pattern = method + " " + route.path
+	}
+
+	// Record the pattern ahead of the group middleware so requests they
+	// reject are labelled with the route too
+	stack := middleware.CreateStack(r.middlewares...)(handler)
+	r.reg.mux.Handle(route.pattern, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		middleware.SetRoutePattern(req.Context(), route.path)
+		stack.ServeHTTP(w, req)
+	}))
+	return route
+}
+
+// HandleFunc registers a handler function, see Handle
+func (r *Router) HandleFunc(pattern string, handler http.HandlerFunc) *Route {
+	return r.Handle(pattern, handler)
+}
+
+// ServeHTTP dispatches to the shared mux. Requests no route matches get the
+// JSON error envelope instead of ServeMux's plain text 404 and 405.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if _, pattern := r.reg.mux.Handler(req); pattern == "" {
+		w = &errorWriter{ResponseWriter: w}
+	}
+	r.reg.mux.ServeHTTP(w, req)
+}
+
+// errorWriter replaces the body ServeMux writes for unmatched requests. The
+// Allow header set for 405 responses is kept.
+type errorWriter struct {
+	http.ResponseWriter
+	replaced bool
+}
+
+func (w *errorWriter) WriteHeader(code int) {
+	var errCode, msg string
+	switch code {
+	case http.StatusNotFound:
+		errCode, msg = utils.ErrCodeNotFound, "route not found"
+	case http.StatusMethodNotAllowed:
+		errCode, msg = utils.ErrCodeMethodNotAllowed, "method not allowed"
+	default:
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.replaced = true
+	w.Header().Del("Content-Type")
+	utils.RespondWithErrorCode(w.ResponseWriter, code, errCode, msg)
+}
+
+func (w *errorWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// URL builds the path of a named route, see Route.URL
+func (r *Router) URL(name string, params ...string) (string, error) {
+	r.reg.mu.RLock()
+	route, ok := r.reg.names[name]
+	r.reg.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("router: no route named %q", name)
+	}
+	return route.URL(params...)
+}
+
+// Name registers the route under name for URL building. Names must be unique.
+func (rt *Route) Name(name string) *Route {
+	rt.reg.mu.Lock()
+	defer rt.reg.mu.Unlock()
+	if _, exists := rt.reg.names[name]; exists {
+		panic(fmt.Sprintf("router: route name %q already registered", name))
+	}
+	rt.reg.names[name] = rt
+	return rt
+}
+
+// Pattern returns the full pattern the route was registered with
+func (rt *Route) Pattern() string {
+	return rt.pattern
+}
+
+// URL fills the route's wildcards from key/value pairs, e.g.
+// URL("id", "42") for "/users/{id}". A trailing {name...} wildcard takes the
+// value as is, other values are path escaped.
+func (rt *Route) URL(params ...string) (string, error) {
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("router: odd number of URL parameters for %q", rt.pattern)
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+
+	segments := strings.Split(rt.path, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		key := strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "}")
+		if key == "$" {
+			segments[i] = ""
+			continue
+		}
+		rest := strings.HasSuffix(key, "...")
+		key = strings.TrimSuffix(key, "...")
+		value, ok := values[key]
+		if !ok {
+			return "", fmt.Errorf("router: missing URL parameter %q for %q", key, rt.pattern)
+		}
+		if rest {
+			segments[i] = strings.TrimPrefix(value, "/")
+		} else {
+			segments[i] = url.PathEscape(value)
+		}
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// splitPattern separates an optional method from the path of a pattern
+func splitPattern(pattern string) (method, path string) {
+	pattern = strings.TrimSpace(pattern)
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 {
+		return pattern[:i], strings.TrimSpace(pattern[i+1:])
+	}
+	return "", pattern
+}
+
+// joinPath joins a prefix and a path, keeping a trailing slash on path
+func joinPath(prefix, path string) string {
+	prefix = strings.TrimRight(prefix, "/")
+	if path == "" {
+		return prefix
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return prefix + path
+}
@@ -0,0 +1,274 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/logger"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/middleware"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
+	"github.com/NhyiraAmofaSekyi/go-webserver/utils"
+)
+
+// tag returns a middleware that appends name to the X-Trace response header
+func tag(name string) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestGroups(t *testing.T) {
+	r := New()
+	r.Use(tag("root"))
+	r.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	r.Group("/api/v1", func(api *Router) {
+		api.Use(tag("api"))
+		api.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("user " + r.PathValue("id")))
+		})
+		api.Group("/admin", func(admin *Router) {
+			admin.Use(tag("admin"))
+			admin.HandleFunc("PUT /settings", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("settings"))
+			})
+		})
+		api.With(tag("with")).HandleFunc("GET /secure", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("secure"))
+		})
+		api.HandleFunc("GET /public", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("public"))
+		})
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		expectedBody   string
+		expectedTrace  string
+	}{
+		{
+			name:           "Root Route",
+			method:         "GET",
+			path:           "/healthz",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "ok",
+			expectedTrace:  "root",
+		},
+		{
+			name:           "Group Route With Path Value",
+			method:         "GET",
+			path:           "/api/v1/users/42",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "user 42",
+			expectedTrace:  "root,api",
+		},
+		{
+			name:           "Nested Group",
+			method:         "PUT",
+			path:           "/api/v1/admin/settings",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "settings",
+			expectedTrace:  "root,api,admin",
+		},
+		{
+			name:           "With Only Applies To Its Routes",
+			method:         "GET",
+			path:           "/api/v1/secure",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "secure",
+			expectedTrace:  "root,api,with",
+		},
+		{
+			name:           "Sibling Unaffected By With",
+			method:         "GET",
+			path:           "/api/v1/public",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "public",
+			expectedTrace:  "root,api",
+		},
+		{
+			name:           "Wrong Method",
+			method:         "POST",
+			path:           "/api/v1/admin/settings",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tt.expectedBody)
+			}
+			if trace := strings.Join(rr.Header().Values("X-Trace"), ","); tt.expectedBody != "" && trace != tt.expectedTrace {
+				t.Errorf("wrong middleware chain: got %q want %q", trace, tt.expectedTrace)
+			}
+		})
+	}
+}
+
+func TestURL(t *testing.T) {
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	r := New()
+	api := r.Group("/api/v1/")
+	api.HandleFunc("GET /users/{id}", noop).Name("users.get")
+	api.HandleFunc("GET /files/{path...}", noop).Name("files.get")
+	api.HandleFunc("GET /{$}", noop).Name("index")
+
+	tests := []struct {
+		name        string
+		route       string
+		params      []string
+		expectedURL string
+		expectError bool
+	}{
+		{name: "Single Wildcard", route: "users.get", params: []string{"id", "42"}, expectedURL: "/api/v1/users/42"},
+		{name: "Escaped Value", route: "users.get", params: []string{"id", "a b/c"}, expectedURL: "/api/v1/users/a%20b%2Fc"},
+		{name: "Rest Wildcard", route: "files.get", params: []string{"path", "a/b.txt"}, expectedURL: "/api/v1/files/a/b.txt"},
+		{name: "Exact Match Marker", route: "index", expectedURL: "/api/v1/"},
+		{name: "Missing Parameter", route: "users.get", expectError: true},
+		{name: "Odd Parameters", route: "users.get", params: []string{"id"}, expectError: true},
+		{name: "Unknown Route", route: "nope", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.URL(tt.route, tt.params...)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got URL %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("URL returned error: %v", err)
+			}
+			if got != tt.expectedURL {
+				t.Errorf("wrong URL: got %q want %q", got, tt.expectedURL)
+			}
+		})
+	}
+}
+
+func TestDuplicateName(t *testing.T) {
+	r := New()
+	r.HandleFunc("GET /a", func(w http.ResponseWriter, r *http.Request) {}).Name("dup")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic for duplicate route name")
+		}
+	}()
+	r.HandleFunc("GET /b", func(w http.ResponseWriter, r *http.Request) {}).Name("dup")
+}
+
+func TestUnmatchedRoutesUseJSONErrors(t *testing.T) {
+	r := New()
+	r.HandleFunc("GET /items", func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		expectedCode   string
+		expectedAllow  string
+	}{
+		{name: "Unknown Path", method: "GET", path: "/nope", expectedStatus: http.StatusNotFound, expectedCode: utils.ErrCodeNotFound},
+		{name: "Wrong Method", method: "DELETE", path: "/items", expectedStatus: http.StatusMethodNotAllowed, expectedCode: utils.ErrCodeMethodNotAllowed, expectedAllow: "GET, HEAD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("handler returned wrong content type: got %v want application/json", contentType)
+			}
+			if allow := rr.Header().Get("Allow"); allow != tt.expectedAllow {
+				t.Errorf("wrong Allow header: got %q want %q", allow, tt.expectedAllow)
+			}
+			var response utils.ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Could not decode response body: %v", err)
+			}
+			if response.Code != tt.expectedCode {
+				t.Errorf("handler returned unexpected error code: got %v want %v", response.Code, tt.expectedCode)
+			}
+		})
+	}
+}
+
+func TestMetricsUseRoutePattern(t *testing.T) {
+	accessLog, err := middleware.NewAccessLog(&middleware.AccessLogConfig{
+		Service: "router-test",
+		Format:  middleware.AccessLogJSON,
+		Output:  "file",
+		File:    logger.FileConfig{Dir: t.TempDir()},
+	})
+	if err != nil {
+		t.Fatalf("NewAccessLog returned error: %v", err)
+	}
+
+	r := New()
+	r.Group("/api", func(api *Router) {
+		api.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("user"))
+		})
+	})
+	handler := accessLog(r)
+	for _, path := range []string{"/api/users/1", "/api/users/2", "/nope"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	families, err := monitoring.Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	counts := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "http_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["service"] == "router-test" {
+				counts[labels["route"]+" "+labels["status_class"]] += metric.GetCounter().GetValue()
+			}
+		}
+	}
+
+	expected := map[string]float64{"/api/users/{id} 2xx": 2, "unmatched 4xx": 1}
+	if len(counts) != len(expected) {
+		t.Errorf("wrong series: got %v want %v", counts, expected)
+	}
+	for series, count := range expected {
+		if counts[series] != count {
+			t.Errorf("wrong count for %q: got %v want %v", series, counts[series], count)
+		}
+	}
+}
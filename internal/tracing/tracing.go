@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const defaultServiceName = "go-webserver"
+
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the host:port of an OTLP/HTTP receiver, e.g. a local
+	// collector on "localhost:4318"
+	Endpoint    string `yaml:"endpoint"`
+	Insecure    bool   `yaml:"insecure"` // plain HTTP instead of HTTPS
+	ServiceName string `yaml:"service_name"`
+	// SampleRatio is the fraction of new traces to record, 0 or 1 records
+	// every trace. Requests carrying a sampled traceparent are always recorded.
+	SampleRatio float64 `yaml:"sample_ratio"`
+	// ExportTimeout bounds each export to the endpoint
+	ExportTimeout time.Duration `yaml:"export_timeout"`
+}
+
+// Init installs W3C trace context propagation and, when enabled, a tracer
+// provider exporting spans over OTLP. The returned function flushes and
+// stops the exporter and must be called on shutdown.
+func Init(ctx context.Context, config *Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if config == nil || !config.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("tracing endpoint is required when tracing is enabled")
+	}
+	if config.SampleRatio < 0 || config.SampleRatio > 1 {
+		return nil, fmt.Errorf("tracing sample ratio must be between 0 and 1, got %v", config.SampleRatio)
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.Endpoint)}
+	if config.Insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	if config.ExportTimeout > 0 {
+		options = append(options, otlptracehttp.WithTimeout(config.ExportTimeout))
+	}
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP exporter: %w", err)
+	}
+
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("creating tracing resource: %w", err)
+	}
+
+	ratio := config.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
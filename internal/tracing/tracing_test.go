@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestInitExportsToCollector(t *testing.T) {
+	received := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("exporter posted to %s, want /v1/traces", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	shutdown, err := Init(context.Background(), &Config{
+		Enabled:     true,
+		Endpoint:    strings.TrimPrefix(collector.URL, "http://"),
+		Insecure:    true,
+		ServiceName: "tracing-test",
+	})
+	if err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "test-span")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown returned error: %v", err)
+	}
+
+	select {
+	case body := <-received:
+		// The body is protobuf, names are stored as plain strings
+		for _, want := range []string{"test-span", "tracing-test"} {
+			if !strings.Contains(string(body), want) {
+				t.Errorf("exported spans do not contain %q", want)
+			}
+		}
+	default:
+		t.Fatal("no spans were exported")
+	}
+}
+
+func TestInitDisabled(t *testing.T) {
+	shutdown, err := Init(context.Background(), &Config{})
+	if err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown returned error: %v", err)
+	}
+
+	// Propagation is installed even without exporting
+	carrier := propagation.HeaderCarrier(http.Header{})
+	carrier.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+	out := propagation.HeaderCarrier(http.Header{})
+	otel.GetTextMapPropagator().Inject(ctx, out)
+	if out.Get("traceparent") == "" {
+		t.Error("traceparent was not propagated")
+	}
+}
+
+func TestInitInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{name: "Missing Endpoint", config: Config{Enabled: true}},
+		{name: "Sample Ratio Above 1", config: Config{Enabled: true, Endpoint: "localhost:4318", SampleRatio: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Init(context.Background(), &tt.config); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
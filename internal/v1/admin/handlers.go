@@ -0,0 +1,224 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/audit"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/features"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/logger"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/middleware"
+	utils "github.com/NhyiraAmofaSekyi/go-webserver/utils"
+)
+
+// Handlers holds the runtime components admins can inspect and change
+type Handlers struct {
+	Maintenance *middleware.Maintenance
+	Captures    *middleware.BodyCapture
+	Features    *features.Service
+	Audit       *audit.Log
+}
+
+func (h *Handlers) GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, h.Maintenance.State())
+}
+
+func (h *Handlers) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Enabled *bool  `json:"enabled"`
+		Message string `json:"message"`
+	}
+
+	params := parameters{}
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		utils.RespondWithAPIError(w, err)
+		return
+	}
+	if params.Enabled == nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "expected JSON body with an enabled field")
+		return
+	}
+
+	userID, _ := r.Context().Value(middleware.AuthUserID).(string)
+	state := h.Maintenance.Set(*params.Enabled, params.Message)
+	logger.Info("Maintenance mode set to %t by %s", state.Enabled, userID)
+	event := middleware.AuditEvent(r, audit.ActionMaintenance, audit.OutcomeSuccess)
+	event.Details = map[string]string{"enabled": strconv.FormatBool(state.Enabled), "message": params.Message}
+	audit.Record(event)
+
+	utils.RespondWithJSON(w, http.StatusOK, state)
+}
+
+// GetCaptures lists the latest debug captures, optionally filtered by the
+// request_id query parameter and capped by limit
+func (h *Handlers) GetCaptures(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			utils.RespondWithError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, h.Captures.Captures(r.URL.Query().Get("request_id"), limit))
+}
+
+func (h *Handlers) ListFeatures(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, h.Features.Flags())
+}
+
+// SetFeature creates or replaces the flag named in the path, the change is
+// stored and applies immediately
+func (h *Handlers) SetFeature(w http.ResponseWriter, r *http.Request) {
+	flag := features.Flag{}
+	if err := utils.DecodeJSON(w, r, &flag); err != nil {
+		utils.RespondWithAPIError(w, err)
+		return
+	}
+	flag.Name = r.PathValue("name")
+	if err := flag.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	event := middleware.AuditEvent(r, audit.ActionFeatureFlag, audit.OutcomeSuccess)
+	event.Target = flag.Name
+	event.Details = map[string]string{
+		"enabled": strconv.FormatBool(flag.Enabled),
+		"rollout": strconv.Itoa(flag.Rollout),
+		"users":   strings.Join(flag.Users, ","),
+		"roles":   strings.Join(flag.Roles, ","),
+	}
+	if err := h.Features.Set(r.Context(), flag); err != nil {
+		event.Outcome = audit.OutcomeFailure
+		audit.Record(event)
+		logger.Error("Failed to set feature flag: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not save feature flag")
+		return
+	}
+	userID, _ := r.Context().Value(middleware.AuthUserID).(string)
+	logger.Info("Feature flag %s set to enabled=%t rollout=%d by %s", flag.Name, flag.Enabled, flag.Rollout, userID)
+	audit.Record(event)
+
+	utils.RespondWithJSON(w, http.StatusOK, flag)
+}
+
+const (
+	defaultLogLevelTTL = 15 * time.Minute
+	maxLogLevelTTL     = 24 * time.Hour
+)
+
+func (h *Handlers) GetLogLevels(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, logger.Levels())
+}
+
+// SetLogLevel changes the global level, or that of a package such as
+// "internal/middleware", until the TTL passes
+func (h *Handlers) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Package string `json:"package"`
+		Level   string `json:"level"`
+		TTL     string `json:"ttl"`
+	}
+
+	params := parameters{}
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		utils.RespondWithAPIError(w, err)
+		return
+	}
+	level, err := logger.ParseLevel(params.Level)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ttl := defaultLogLevelTTL
+	if params.TTL != "" {
+		if ttl, err = time.ParseDuration(params.TTL); err != nil || ttl <= 0 || ttl > maxLogLevelTTL {
+			utils.RespondWithError(w, http.StatusBadRequest, "ttl must be a positive duration of at most "+maxLogLevelTTL.String())
+			return
+		}
+	}
+
+	setting := logger.SetLevel(r.Context(), params.Package, level, ttl)
+	event := middleware.AuditEvent(r, audit.ActionLogLevel, audit.OutcomeSuccess)
+	event.Target = params.Package
+	event.Details = map[string]string{"level": setting.Level, "ttl": ttl.String()}
+	audit.Record(event)
+	utils.RespondWithJSON(w, http.StatusOK, setting)
+}
+
+// ResetLogLevel removes the override of the package query parameter, or of
+// the global level when it is empty
+func (h *Handlers) ResetLogLevel(w http.ResponseWriter, r *http.Request) {
+	pkg := r.URL.Query().Get("package")
+	if !logger.ResetLevel(r.Context(), pkg) {
+		utils.RespondWithError(w, http.StatusNotFound, "no log level override for this package")
+		return
+	}
+	event := middleware.AuditEvent(r, audit.ActionLogLevel, audit.OutcomeSuccess)
+	event.Target = pkg
+	event.Details = map[string]string{"level": "reset"}
+	audit.Record(event)
+	utils.RespondWithJSON(w, http.StatusOK, logger.Levels())
+}
+
+// ListAuditEvents returns audit events newest first, filtered by the actor,
+// action, since and until (RFC 3339) query parameters. Pass the ID of the
+// last event as before_id to get the next page.
+func (h *Handlers) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Actor:  query.Get("actor"),
+		Action: query.Get("action"),
+	}
+	for name, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				utils.RespondWithError(w, http.StatusBadRequest, name+" must be an RFC 3339 time")
+				return
+			}
+			*dst = t
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit < 0 {
+			utils.RespondWithError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+	}
+	if value := query.Get("before_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			utils.RespondWithError(w, http.StatusBadRequest, "before_id must be a positive integer")
+			return
+		}
+		filter.BeforeID = id
+	}
+
+	events, err := h.Audit.Events(r.Context(), filter)
+	if err != nil {
+		logger.Error("Failed to list audit events: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not list audit events")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, events)
+}
+
+// VerifyAuditLog recomputes the hash chain, a broken chain means events
+// were changed or removed outside the application
+func (h *Handlers) VerifyAuditLog(w http.ResponseWriter, r *http.Request) {
+	result, err := h.Audit.Verify(r.Context())
+	if err != nil {
+		logger.Error("Failed to verify audit log: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "could not verify audit log")
+		return
+	}
+	if !result.Valid {
+		logger.Error("Audit log hash chain broken at event %d: %s", result.BrokenAt, result.Reason)
+	}
+	utils.RespondWithJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,22 @@
+package admin
+
+import (
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/middleware"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/router"
+)
+
+// Register adds the admin routes to r, all of which require an admin token
+func Register(r *router.Router, h *Handlers) {
+	r.Use(middleware.Auth, middleware.RequireRole("admin"))
+
+	r.HandleFunc("GET /maintenance", h.GetMaintenance).Name("admin.getMaintenance")
+	r.HandleFunc("PUT /maintenance", h.SetMaintenance).Name("admin.setMaintenance")
+	r.HandleFunc("GET /debug/captures", h.GetCaptures).Name("admin.getCaptures")
+	r.HandleFunc("GET /features", h.ListFeatures).Name("admin.listFeatures")
+	r.HandleFunc("PUT /features/{name}", h.SetFeature).Name("admin.setFeature")
+	r.HandleFunc("GET /log-levels", h.GetLogLevels).Name("admin.getLogLevels")
+	r.HandleFunc("PUT /log-levels", h.SetLogLevel).Name("admin.setLogLevel")
+	r.HandleFunc("DELETE /log-levels", h.ResetLogLevel).Name("admin.resetLogLevel")
+	r.HandleFunc("GET /audit", h.ListAuditEvents).Name("admin.listAuditEvents")
+	r.HandleFunc("GET /audit/verify", h.VerifyAuditLog).Name("admin.verifyAuditLog")
+}
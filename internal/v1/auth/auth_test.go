@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	jwtauth "github.com/NhyiraAmofaSekyi/go-webserver/internal/auth"
 )
 
 func TestSignIn(t *testing.T) {
@@ -19,7 +21,7 @@ func TestSignIn(t *testing.T) {
 		}
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(SignIn)
+		handler := http.HandlerFunc((&Handlers{}).SignIn)
 
 		handler.ServeHTTP(rr, req)
 
@@ -52,7 +54,7 @@ func TestSignIn(t *testing.T) {
 		}
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(SignIn)
+		handler := http.HandlerFunc((&Handlers{}).SignIn)
 
 		handler.ServeHTTP(rr, req)
 
@@ -61,3 +63,48 @@ func TestSignIn(t *testing.T) {
 		}
 	})
 }
+
+func TestSignInRole(t *testing.T) {
+	handlers := &Handlers{Admins: map[string]string{"ama": "correct-horse-battery"}}
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedRole   string
+	}{
+		{name: "Admin User", body: `{"name":"ama","secret":"correct-horse-battery"}`, expectedStatus: http.StatusOK, expectedRole: "admin"},
+		{name: "Admin Without Secret", body: `{"name":"ama"}`, expectedStatus: http.StatusUnauthorized},
+		{name: "Admin With Wrong Secret", body: `{"name":"ama","secret":"correct-horse"}`, expectedStatus: http.StatusUnauthorized},
+		{name: "Other User", body: `{"name":"kofi"}`, expectedStatus: http.StatusOK},
+		{name: "Empty Name", body: `{"name":""}`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/signin", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			handlers.SignIn(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			responseMap := make(map[string]string)
+			if err := json.Unmarshal(rr.Body.Bytes(), &responseMap); err != nil {
+				t.Fatalf("could not parse response: %v", err)
+			}
+			// The token must be accepted by the auth middleware
+			claims, err := jwtauth.ParseJWT(responseMap["token"])
+			if err != nil {
+				t.Fatalf("token was not valid: %v", err)
+			}
+			if role, _ := claims["role"].(string); role != tt.expectedRole {
+				t.Errorf("wrong role claim: got %q want %q", role, tt.expectedRole)
+			}
+		})
+	}
+}
@@ -1,36 +1,22 @@
 package auth
 
 import (
-	"encoding/json"
+	"crypto/sha256"
+	"crypto/subtle"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/audit"
+	jwtauth "github.com/NhyiraAmofaSekyi/go-webserver/internal/auth"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/middleware"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
 	utils "github.com/NhyiraAmofaSekyi/go-webserver/utils"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 var hmacSampleSecret = []byte("sample")
 
-// Function to generate a new JWT for a given name
-func GenerateJWT(name string) (string, error) {
-	expirationTime := time.Now().Add(1 * time.Hour).Unix()
-	// Create a new token object, specifying signing method and the claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"name": name, // Include the name in the token
-		"nbf":  time.Now().Unix(),
-		"exp":  expirationTime,
-	})
-
-	// Sign and get the complete encoded token as a string using the secret
-	tokenString, err := token.SignedString(hmacSampleSecret)
-	if err != nil {
-		return "", err
-	}
-
-	return tokenString, nil
-}
-
 func GenerateTestToken(name string, valid bool) string {
 	var expirationTime int64
 	if valid {
@@ -48,32 +34,85 @@ func GenerateTestToken(name string, valid bool) string {
 	return tokenString
 }
 
-func SignIn(w http.ResponseWriter, r *http.Request) {
+// Handlers issues tokens on sign-in
+type Handlers struct {
+	// Admins maps the users given the admin role to the secret they must
+	// sign in with, from ADMIN_USERS
+	Admins map[string]string
+}
+
+// validSecret compares the secrets in constant time, hashing them first so
+// their lengths are not revealed either
+func validSecret(given, want string) bool {
+	a, b := sha256.Sum256([]byte(given)), sha256.Sum256([]byte(want))
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+}
+
+func (h *Handlers) SignIn(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Name string `json:"name"`
+		Name   string `json:"name"`
+		Secret string `json:"secret"` // required for admins
 	}
 
 	// ctx := context.WithValue(r.Context(), middleware.Skey, "auth")
 	// req := r.WithContext(ctx)
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err := decoder.Decode(&params)
-	if err != nil {
-		utils.RespondWithJSON(w, http.StatusBadRequest, fmt.Sprintf("Error passing json: %v", err))
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		monitoring.AuthSignInsTotal.WithLabelValues("invalid_request").Inc()
+		audit.Record(signInEvent(r, "", audit.OutcomeFailure, "invalid_request"))
+		utils.RespondWithAPIError(w, err)
+		return
+	}
+	if params.Name == "" {
+		monitoring.AuthSignInsTotal.WithLabelValues("invalid_request").Inc()
+		audit.Record(signInEvent(r, "", audit.OutcomeFailure, "invalid_request"))
+		utils.RespondWithError(w, http.StatusBadRequest, "expected JSON body with a name field")
 		return
 	}
 
-	jwtToken, err := GenerateJWT(params.Name)
+	// An admin name without the admin's secret gets no token at all
+	role := ""
+	if secret, ok := h.Admins[params.Name]; ok {
+		if !validSecret(params.Secret, secret) {
+			monitoring.AuthSignInsTotal.WithLabelValues("invalid_credentials").Inc()
+			audit.Record(signInEvent(r, params.Name, audit.OutcomeFailure, "invalid_credentials"))
+			utils.RespondWithError(w, http.StatusUnauthorized, "invalid credentials")
+			return
+		}
+		role = "admin"
+	}
+	jwtToken, err := jwtauth.GenerateJWTWithRole(params.Name, role)
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusBadRequest, fmt.Sprintf("Error passing json: %v", err))
+		monitoring.AuthSignInsTotal.WithLabelValues("error").Inc()
+		audit.Record(signInEvent(r, params.Name, audit.OutcomeFailure, "error"))
+		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error generating token: %v", err))
 		return
 	}
 
+	monitoring.AuthSignInsTotal.WithLabelValues("success").Inc()
+	event := signInEvent(r, params.Name, audit.OutcomeSuccess, "")
+	if role != "" {
+		event.Details = map[string]string{"role": role}
+	}
+	audit.Record(event)
 	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "ok", "route": "auth sign in", "token": jwtToken})
 }
 
+// signInEvent audits a sign-in as name, who is not authenticated yet
+func signInEvent(r *http.Request, name string, outcome string, reason string) audit.Event {
+	event := middleware.AuditEvent(r, audit.ActionSignIn, outcome)
+	if name != "" {
+		event.Actor = name
+	}
+	if reason != "" {
+		event.Details = map[string]string{"reason": reason}
+	}
+	return event
+}
+
 func SignOut(w http.ResponseWriter, r *http.Request) {
 
+	audit.Record(middleware.AuditEvent(r, audit.ActionSignOut, audit.OutcomeSuccess))
 	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "ok", "route": "auth sign out"})
 }
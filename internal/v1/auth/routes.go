@@ -1,15 +1,11 @@
 package auth
 
 import (
-	"net/http"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/router"
 )
 
-// NewRouter returns a new http.ServeMux with v1 routes configured
-func NewRouter() *http.ServeMux {
-	authRouter := http.NewServeMux()
-
-	authRouter.HandleFunc("POST /signIn", SignIn) // Note the path is just "/healthz" now
-	authRouter.HandleFunc("GET /SignOut", SignOut)
-
-	return authRouter
+// Register adds the auth routes to r
+func Register(r *router.Router, h *Handlers) {
+	r.HandleFunc("POST /signIn", h.SignIn).Name("auth.signIn")
+	r.HandleFunc("GET /SignOut", SignOut).Name("auth.signOut")
 }
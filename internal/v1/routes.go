@@ -2,22 +2,52 @@
 package v1
 
 import (
-	"net/http"
-
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/audit"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/features"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/health"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/middleware"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/router"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/v1/admin"
 	"github.com/NhyiraAmofaSekyi/go-webserver/internal/v1/auth"
 	"github.com/NhyiraAmofaSekyi/go-webserver/internal/v1/users"
 )
 
-// NewRouter returns a new http.ServeMux with v1 routes configured
-func NewRouter() *http.ServeMux {
-	v1Router := http.NewServeMux()
-	authRouter := auth.NewRouter()
-	userRouter := users.NewRouter()
+// Options holds the runtime components shared with the v1 handlers
+type Options struct {
+	Maintenance   *middleware.Maintenance
+	AdminFilter   middleware.Middleware // optional, restricts /admin/ by client IP
+	ResponseCache *middleware.ResponseCache
+	BodyCapture   *middleware.BodyCapture
+	Features      *features.Service
+	Health        *health.Registry
+	Audit         *audit.Log
+	AdminUsers    map[string]string // signed in with the admin role, by secret
+}
 
-	v1Router.HandleFunc("GET /healthz", HealthzHandler) // Note the path is just "/healthz" now
-	v1Router.HandleFunc("GET /secure", SecureHandler)
-	v1Router.Handle("/auth/", http.StripPrefix("/auth", authRouter))
-	v1Router.Handle("/users/", http.StripPrefix("/users", userRouter))
+// Register adds the v1 routes to r, which is normally a group at /api/v1
+func Register(r *router.Router, opts Options) {
+	r.HandleFunc("GET /livez", opts.Health.Handler(health.Liveness)).Name("v1.livez")
+	r.HandleFunc("GET /readyz", opts.Health.Handler(health.Readiness)).Name("v1.readyz")
+	r.HandleFunc("GET /startupz", opts.Health.Handler(health.Startup)).Name("v1.startupz")
+	// Kept for existing monitors, same as /livez
+	r.HandleFunc("GET /healthz", opts.Health.Handler(health.Liveness)).Name("v1.healthz")
+	r.With(middleware.Auth).HandleFunc("GET /secure", SecureHandler).Name("v1.secure")
 
-	return v1Router
+	r.Group("/auth", func(authGroup *router.Router) {
+		auth.Register(authGroup, &auth.Handlers{Admins: opts.AdminUsers})
+	})
+	r.Group("/users", func(usersGroup *router.Router) {
+		users.Register(usersGroup, opts.ResponseCache)
+	})
+	r.Group("/admin", func(adminGroup *router.Router) {
+		if opts.AdminFilter != nil {
+			adminGroup.Use(opts.AdminFilter)
+		}
+		admin.Register(adminGroup, &admin.Handlers{
+			Maintenance: opts.Maintenance,
+			Captures:    opts.BodyCapture,
+			Features:    opts.Features,
+			Audit:       opts.Audit,
+		})
+	})
 }
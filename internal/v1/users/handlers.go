@@ -1,18 +1,21 @@
 package users
 
 import (
-	"encoding/json"
 	"fmt"
+	"html/template"
 	"io"
 	"log"
 	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"text/template"
 
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/audit"
 	"github.com/NhyiraAmofaSekyi/go-webserver/internal/config"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/middleware"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
 	utils "github.com/NhyiraAmofaSekyi/go-webserver/utils"
 	aws "github.com/NhyiraAmofaSekyi/go-webserver/utils/aws/awsS3"
 	email "github.com/NhyiraAmofaSekyi/go-webserver/utils/email"
@@ -26,17 +29,15 @@ func MailHandler(w http.ResponseWriter, r *http.Request) {
 		Subject string `json:"subject"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err := decoder.Decode(&params)
-	if err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{"message": "server error"})
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		utils.RespondWithAPIError(w, err)
 		return
 	}
 
-	err = email.SendMail(params.Subject, params.Email, params.Name)
+	err := email.SendMail(r.Context(), params.Subject, params.Email, params.Name)
 	if err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{"message": "failed to send email"})
+		utils.RespondWithError(w, http.StatusInternalServerError, "failed to send email")
 		return
 	}
 	fmt.Fprintln(w, "Mail sent successfully")
@@ -50,15 +51,13 @@ func HtmlMailHandler(w http.ResponseWriter, r *http.Request) {
 		Subject string `json:"subject"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err := decoder.Decode(&params)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "error parsing json")
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		utils.RespondWithAPIError(w, err)
 		return
 	}
 
-	err = email.SendHTML(params.Subject, params.Email, params.Name)
+	err := email.SendHTML(r.Context(), params.Subject, params.Email, params.Name)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "error sending email")
 		return
@@ -81,11 +80,13 @@ func FileForm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Data to pass to the template
+	// Data to pass to the template, the nonce allows inline styles under the CSP
 	data := struct {
 		Endpoint string
+		Nonce    string
 	}{
 		Endpoint: endpoint,
+		Nonce:    middleware.CSPNonce(r.Context()),
 	}
 
 	// Execute the template with the data
@@ -96,7 +97,7 @@ func FileForm(w http.ResponseWriter, r *http.Request) {
 
 func ListObj(w http.ResponseWriter, r *http.Request) {
 
-	err := aws.ListBucketOBJ()
+	err := aws.ListBucketOBJ(r.Context())
 
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
@@ -110,15 +111,13 @@ func GetObj(w http.ResponseWriter, r *http.Request) {
 		Key string `json:"key"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err := decoder.Decode(&params)
-	if err != nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{"message": "server error"})
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		utils.RespondWithAPIError(w, err)
 		return
 	}
 
-	_, err = aws.GetObject(params.Key, "arn:aws:s3:eu-north-1:049991758581:accesspoint/test2")
+	_, err := aws.GetObject(r.Context(), params.Key, "arn:aws:s3:eu-north-1:049991758581:accesspoint/test2")
 	bucket := os.Getenv("AWS_BUCKET")
 	region := os.Getenv("AWS_BUCKET_REGION")
 	url := "https://" + bucket + ".s3." + region + ".amazonaws.com/" + params.Key
@@ -167,13 +166,28 @@ func Upload(w http.ResponseWriter, r *http.Request) {
 
 	key := id.String() + fileType
 
-	err = aws.Upload(bucket, key, file, contentType)
+	mediaType := contentTypeLabel(contentType)
+	event := middleware.AuditEvent(r, audit.ActionFileUpload, audit.OutcomeSuccess)
+	event.Target = key
+	event.Details = map[string]string{
+		"file_name":    handler.Filename,
+		"content_type": mediaType,
+		"size":         strconv.Itoa(fileSize),
+	}
+	err = aws.Upload(r.Context(), bucket, key, file, contentType)
 	if err != nil {
+		monitoring.UploadsTotal.WithLabelValues(mediaType, "failed").Inc()
+		event.Outcome = audit.OutcomeFailure
+		audit.Record(event)
 		log.Printf(" upload error %v", err)
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error uploading")
 		return
 	}
 
+	monitoring.UploadsTotal.WithLabelValues(mediaType, "success").Inc()
+	monitoring.UploadBytesTotal.WithLabelValues(mediaType).Add(float64(fileSize))
+	audit.Record(event)
+
 	url := "https://" + bucket + ".s3." + region + ".amazonaws.com/" + key
 	response := map[string]interface{}{
 		"fileName": handler.Filename,
@@ -189,20 +203,34 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 		Name string `json:"name"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-
-	err := decoder.Decode(&params)
-	if err != nil {
-		utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"message": "bad request"})
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		utils.RespondWithAPIError(w, err)
 		return
 	}
 
+	event := middleware.AuditEvent(r, audit.ActionUserCreate, audit.OutcomeSuccess)
+	event.Details = map[string]string{"name": params.Name}
 	user, err := config.Config.DBConfig.DB.CreateUser(r.Context(), params.Name)
 	if err != nil {
+		event.Outcome = audit.OutcomeFailure
+		audit.Record(event)
 		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	monitoring.UsersCreatedTotal.Inc()
+	event.Target = user.ID.String()
+	audit.Record(event)
 
 	utils.RespondWithJSON(w, http.StatusOK, user)
 }
+
+// contentTypeLabel drops parameters such as charset from a content type so
+// the metric label only takes values from the extension table
+func contentTypeLabel(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
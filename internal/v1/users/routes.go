@@ -1,19 +1,37 @@
 package users
 
 import (
-	"net/http"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/config"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/middleware"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/router"
 )
 
-func NewRouter() *http.ServeMux {
-	userRouter := http.NewServeMux()
+// objectsCacheTag marks cached responses that list bucket objects
+const objectsCacheTag = "objects"
 
-	userRouter.HandleFunc("POST /sendMail", MailHandler)
-	userRouter.HandleFunc("POST /sendHTML", HtmlMailHandler)
-	userRouter.HandleFunc("/fileForm", FileForm)
-	userRouter.HandleFunc("/upload", Upload)
-	userRouter.HandleFunc("/listObj", ListObj)
-	userRouter.HandleFunc("/getObj", GetObj)
-	userRouter.HandleFunc("/createUser", CreateUser)
+// uploadsFeature is the flag admins turn off to stop uploads at runtime
+const uploadsFeature = "uploads"
 
-	return userRouter
+// Register adds the user routes to r, object listings are cached in
+// responseCache until an upload succeeds
+func Register(r *router.Router, responseCache *middleware.ResponseCache) {
+	r.HandleFunc("POST /sendMail", MailHandler).Name("users.sendMail")
+	r.HandleFunc("POST /sendHTML", HtmlMailHandler).Name("users.sendHTML")
+	r.HandleFunc("/fileForm", FileForm).Name("users.fileForm")
+	r.With(responseCache.Cache(0, objectsCacheTag)).HandleFunc("/listObj", ListObj).Name("users.listObj")
+	r.HandleFunc("/getObj", GetObj).Name("users.getObj")
+
+	// Retried POSTs with the same Idempotency-Key replay the first response
+	idempotency := middleware.Idempotency(
+		middleware.NewPostgresIdempotencyStore(config.Config.DBConfig.DB),
+		&config.Config.Idempotency,
+	)
+	// The flag is checked first so a 404 while uploads are off is not replayed.
+	// Uploads are anonymous, so only turning the flag off for everyone applies.
+	r.With(
+		middleware.RequireFeature(uploadsFeature),
+		idempotency,
+		responseCache.InvalidateAfter(objectsCacheTag),
+	).HandleFunc("POST /upload", Upload).Name("users.upload")
+	r.With(idempotency).HandleFunc("/createUser", CreateUser).Name("users.createUser")
 }
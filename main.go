@@ -2,27 +2,37 @@ package main
 
 import (
 	"context"
+	"errors"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
-	"strings"
 	"syscall"
 	"time"
 
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/audit"
 	"github.com/NhyiraAmofaSekyi/go-webserver/internal/config"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/debugserver"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/errreport"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/features"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/health"
 	"github.com/NhyiraAmofaSekyi/go-webserver/internal/logger"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
 	_ "github.com/lib/pq"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	middleware "github.com/NhyiraAmofaSekyi/go-webserver/internal/middleware"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/router"
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/tracing"
 	v1 "github.com/NhyiraAmofaSekyi/go-webserver/internal/v1"
+	aws "github.com/NhyiraAmofaSekyi/go-webserver/utils/aws/awsS3"
+	"github.com/NhyiraAmofaSekyi/go-webserver/utils/email"
 )
 
 func main() {
 
 	start := time.Now()
-	router := http.NewServeMux()
+	root := router.New()
 
 	config.Initialise()
 	Config := config.Config
@@ -30,20 +40,161 @@ func main() {
 
 	logger.Info("Initializing server on port: %s", port)
 
-	v1 := v1.NewRouter()
+	shutdownTracing, err := tracing.Init(context.Background(), &Config.Tracing)
+	if err != nil {
+		logger.Fatal("Invalid tracing configuration: %v", err)
+	}
+
+	maintenance := middleware.NewMaintenance(&Config.Maintenance)
+
+	realIP, err := middleware.NewRealIP(&Config.RealIP)
+	if err != nil {
+		logger.Fatal("Invalid trusted proxy configuration: %v", err)
+	}
+	metricsFilter, err := middleware.NewIPFilter(&Config.IPFilters.Metrics)
+	if err != nil {
+		logger.Fatal("Invalid metrics IP filter: %v", err)
+	}
+	adminFilter, err := middleware.NewIPFilter(&Config.IPFilters.Admin)
+	if err != nil {
+		logger.Fatal("Invalid admin IP filter: %v", err)
+	}
+
 	api := "/api/v1/"
-	router.Handle(api, http.StripPrefix(strings.TrimRight(api, "/"), v1))
-	router.Handle("/metrics", promhttp.Handler())
+	featureFlags, err := features.NewService(Config.Features, features.NewPostgresStore(Config.DBConfig.DB))
+	if err != nil {
+		logger.Fatal("Invalid feature flag configuration: %v", err)
+	}
+	if err := featureFlags.Load(context.Background()); err != nil {
+		logger.Warn("Using feature flags from config only: %v", err)
+	}
+	// Pick up flags changed through the admin API of other instances
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := featureFlags.Load(context.Background()); err != nil {
+				logger.Error("Failed to reload feature flags: %v", err)
+			}
+		}
+	}()
+
+	errorReporter, err := errreport.New(&Config.ErrorReporting)
+	if err != nil {
+		logger.Fatal("Invalid error reporting configuration: %v", err)
+	}
+	logger.AddHook(errorReporter.LogHook)
+
+	auditLog := audit.NewLog(audit.NewPostgresStore(Config.DBConfig), &Config.Audit)
+	audit.SetDefault(auditLog)
+
+	healthChecks := health.NewRegistry(&Config.Health)
+	healthChecks.Register(health.Readiness, "maintenance", func(ctx context.Context) error {
+		if maintenance.Enabled() {
+			return errors.New("maintenance mode is enabled")
+		}
+		return nil
+	})
+	healthChecks.Register(health.Startup, "postgres", Config.DBConfig.Conn.PingContext)
+	healthChecks.Register(health.Readiness, "postgres", Config.DBConfig.Conn.PingContext)
+	if bucket := os.Getenv("AWS_BUCKET"); bucket != "" {
+		healthChecks.Register(health.Readiness, "s3", func(ctx context.Context) error {
+			return aws.HeadBucket(ctx, bucket)
+		})
+	}
+	healthChecks.Register(health.Readiness, "smtp", email.Ping)
+
+	responseCache := middleware.NewResponseCache("api", &Config.ResponseCache)
+	bodyCapture := middleware.NewBodyCapture(&Config.BodyCapture)
+	v1.Register(root.Group(api), v1.Options{
+		Maintenance:   maintenance,
+		AdminFilter:   adminFilter,
+		ResponseCache: responseCache,
+		BodyCapture:   bodyCapture,
+		Features:      featureFlags,
+		Health:        healthChecks,
+		Audit:         auditLog,
+		AdminUsers:    Config.AdminUsers,
+	})
+	if err := monitoring.Configure(&Config.Metrics); err != nil {
+		logger.Fatal("Invalid metrics configuration: %v", err)
+	}
+	metricsProtection := []middleware.Middleware{metricsFilter}
+	switch {
+	case Config.Metrics.Username != "":
+		metricsProtection = append(metricsProtection, middleware.BasicAuth("metrics", Config.Metrics.Username, Config.Metrics.Password))
+	case Config.Metrics.Token != "":
+		metricsProtection = append(metricsProtection, middleware.BearerAuth("metrics", Config.Metrics.Token))
+	}
+
+	var debugServer *http.Server
+	if Config.DebugServer.Enabled {
+		debugServer, err = debugserver.NewServer(&Config.DebugServer)
+		if err != nil {
+			logger.Fatal("Invalid debug server configuration: %v", err)
+		}
+	}
+	// /metrics is served on its own listener if configured, otherwise on the
+	// debug listener when it is on, otherwise on the API port
+	var metricsServer *http.Server
+	switch {
+	case Config.Metrics.Addr != "":
+		metricsServer = &http.Server{
+			Addr:              Config.Metrics.Addr,
+			Handler:           middleware.CreateStack(metricsProtection...)(monitoring.Handler()),
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       120 * time.Second,
+		}
+	case !Config.DebugServer.Enabled:
+		root.With(metricsProtection...).Handle("/metrics", monitoring.Handler())
+	}
 
 	logger.Debug("Routes configured. API path: %s", api)
 
+	// Expired idempotency keys are overwritten on reuse, this only keeps the table small
+	idempotencyStore := middleware.NewPostgresIdempotencyStore(Config.DBConfig.DB)
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := idempotencyStore.PurgeExpired(context.Background()); err != nil {
+				logger.Error("Failed to purge expired idempotency keys: %v", err)
+			}
+		}
+	}()
+
+	cors, err := middleware.NewCorsPolicies(Config.Cors)
+	if err != nil {
+		logger.Fatal("Invalid CORS configuration: %v", err)
+	}
+
+	accessLog, err := middleware.NewAccessLog(&Config.AccessLog)
+	if err != nil {
+		logger.Fatal("Invalid access log configuration: %v", err)
+	}
+
+	loadShedder, err := middleware.NewLoadShedder(&Config.LoadShedding)
+	if err != nil {
+		logger.Fatal("Invalid load shedding configuration: %v", err)
+	}
+
 	stack := middleware.CreateStack(
-		middleware.Logging,
-		middleware.CorsWrapper,
+		realIP,
+		middleware.RequestID,
+		accessLog,
+		middleware.Tracing,
+		middleware.ErrorReporting(errorReporter),
+		loadShedder,
+		bodyCapture.Middleware,
+		middleware.Features(featureFlags),
+		middleware.SecurityHeaders(&Config.SecurityHeaders),
+		cors,
+		maintenance.Middleware,
 	)
 
 	server := &http.Server{
-		Handler: stack(router),
+		Handler: stack(root),
 		Addr:    ":" + port, // Listen address
 		// Other configurations like ReadTimeout, WriteTimeout, etc.
 		ReadTimeout:       5 * time.Second,
@@ -52,38 +203,73 @@ func main() {
 		ReadHeaderTimeout: 5 * time.Second,
 		MaxHeaderBytes:    1 << 20,
 	}
+	// Stop reusing connections while in maintenance so clients drain to other instances
+	maintenance.OnChange(func(state middleware.MaintenanceState) {
+		server.SetKeepAlivesEnabled(!state.Enabled)
+		logger.Info("Maintenance mode enabled: %t", state.Enabled)
+	})
+	if maintenance.Enabled() {
+		server.SetKeepAlivesEnabled(false)
+	}
+
+	// SIGUSR1 toggles maintenance mode without a redeploy
+	toggle := make(chan os.Signal, 1)
+	signal.Notify(toggle, syscall.SIGUSR1)
+	go func() {
+		for range toggle {
+			maintenance.Toggle()
+		}
+	}()
+
+	// SIGHUP reopens the log file after logrotate has moved it
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := logger.Reopen(); err != nil {
+				logger.Error("Failed to reopen log file: %v", err)
+				continue
+			}
+			logger.Info("Log file reopened")
+		}
+	}()
+
 	// Create a channel to listen for interrupt signals.
 	quit := make(chan os.Signal, 1)
 	// Register the given channel to receive notifications of the specified signals.
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
+	// Listen before serving so the server counts as started once the port is bound
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		logger.Fatal("Error starting server: %v", err)
+	}
+
 	// Start the server in a goroutine.
 	go func() {
 		logger.Info("Starting server...")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			logger.Error("Error starting server: %v", err)
 		}
 	}()
-	healthEndpoint := "http://" + Config.APIHost + ":" + port + api + "healthz"
-
-	logger.Debug("Health check endpoint: %s", healthEndpoint)
-
-	go func() {
-		for {
-
-			resp, err := http.Get(healthEndpoint)
-			if err == nil && resp.StatusCode == http.StatusOK {
-				elapsed := time.Since(start)
-				logger.Info("Server ready in %s", elapsed)
-				resp.Body.Close()
-				break
+	if debugServer != nil {
+		go func() {
+			logger.Info("Starting debug server on %s", debugServer.Addr)
+			if err := debugServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Error starting debug server: %v", err)
 			}
-			if resp != nil {
-				resp.Body.Close()
+		}()
+	}
+	if metricsServer != nil {
+		go func() {
+			logger.Info("Starting metrics server on %s", metricsServer.Addr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Error starting metrics server: %v", err)
 			}
-			time.Sleep(100 * time.Millisecond)
-		}
-	}()
+		}()
+	}
+	healthChecks.MarkStarted()
+	logger.Info("Server ready in %s", time.Since(start))
 
 	// Block until a signal is received.
 	<-quit
@@ -93,11 +279,41 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Fail readiness first so load balancers stop sending new requests
+	healthChecks.Shutdown(ctx)
+
 	//gracefully shut down the server.
 	if err := server.Shutdown(ctx); err != nil {
 		logger.Error("Server shutdown failed: %v", err)
 	}
 
+	if debugServer != nil {
+		if err := debugServer.Shutdown(ctx); err != nil {
+			logger.Error("Debug server shutdown failed: %v", err)
+		}
+	}
+
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			logger.Error("Metrics server shutdown failed: %v", err)
+		}
+	}
+
+	// Write the audit events of the requests served during shutdown
+	if err := auditLog.Close(ctx); err != nil {
+		logger.Error("Audit log shutdown failed: %v", err)
+	}
+
+	// Send the errors of the requests served during shutdown
+	if err := errorReporter.Close(ctx); err != nil {
+		logger.Warn("Error reporting shutdown failed: %v", err)
+	}
+
+	// Flush spans of the requests served during shutdown
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("Tracing shutdown failed: %v", err)
+	}
+
 	logger.Info("Server gracefully stopped")
 
 }
@@ -12,11 +12,43 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func ListBucketOBJ() error {
+const tracerName = "github.com/NhyiraAmofaSekyi/go-webserver/utils/aws/awsS3"
+
+// startSpan starts a client span for an S3 operation, end it with endSpan
+func startSpan(ctx context.Context, operation string, bucket string, key string) (context.Context, trace.Span) {
+	attributes := []attribute.KeyValue{
+		semconv.RPCSystemKey.String("aws-api"),
+		semconv.RPCService("S3"),
+		semconv.RPCMethod(operation),
+		semconv.AWSS3Bucket(bucket),
+	}
+	if key != "" {
+		attributes = append(attributes, semconv.AWSS3Key(key))
+	}
+	return otel.Tracer(tracerName).Start(ctx, "S3."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func ListBucketOBJ(ctx context.Context) error {
 	// Load the Shared AWS Configuration (~/.aws/config)
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("eu-north-1"))
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("eu-north-1"))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -24,10 +56,13 @@ func ListBucketOBJ() error {
 	// Create an Amazon S3 service client
 	client := s3.NewFromConfig(cfg)
 
+	bucket := "arn:aws:s3:eu-north-1:049991758581:accesspoint/test2"
 	// Get the first page of results for ListObjectsV2 for a bucket
-	output, err := client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
-		Bucket: aws.String("arn:aws:s3:eu-north-1:049991758581:accesspoint/test2"),
+	ctx, span := startSpan(ctx, "ListObjectsV2", bucket, "")
+	output, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
 	})
+	endSpan(span, err)
 
 	if err != nil {
 
@@ -42,9 +77,9 @@ func ListBucketOBJ() error {
 	return nil
 }
 
-func GetObject(name string, bucket string) (*s3.GetObjectOutput, error) {
+func GetObject(ctx context.Context, name string, bucket string) (*s3.GetObjectOutput, error) {
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("eu-north-1"))
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("eu-north-1"))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -60,11 +95,13 @@ func GetObject(name string, bucket string) (*s3.GetObjectOutput, error) {
 	client := s3.NewFromConfig(cfg)
 
 	// Attempt to get the object from the S3 bucket
-	resp, err := client.GetObject(context.TODO(), &s3.GetObjectInput{
+	ctx, span := startSpan(ctx, "GetObject", bucket, name)
+	resp, err := client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket:       aws.String(bucket),          // Specify the bucket name
 		Key:          aws.String(name),            // Specify the object key
 		RequestPayer: types.RequestPayerRequester, // Set who pays for the request
 	})
+	endSpan(span, err)
 
 	if err != nil {
 		// If there is an error, return nil for the object and the error
@@ -75,7 +112,7 @@ func GetObject(name string, bucket string) (*s3.GetObjectOutput, error) {
 	return resp, nil
 }
 
-func UploadFile(bucketName string, objectKey string, fileName string, contentType string) error {
+func UploadFile(ctx context.Context, bucketName string, objectKey string, fileName string, contentType string) error {
 
 	if bucketName == "" {
 		return fmt.Errorf("bucket name cannot be empty")
@@ -90,7 +127,7 @@ func UploadFile(bucketName string, objectKey string, fileName string, contentTyp
 		return fmt.Errorf("content type cannot be empty")
 	}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("eu-north-1"))
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("eu-north-1"))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -104,12 +141,14 @@ func UploadFile(bucketName string, objectKey string, fileName string, contentTyp
 	} else {
 		defer file.Close()
 		println(contentType)
-		_, err = client.PutObject(context.TODO(), &s3.PutObjectInput{
+		ctx, span := startSpan(ctx, "PutObject", bucketName, objectKey)
+		_, err = client.PutObject(ctx, &s3.PutObjectInput{
 			Bucket:      aws.String(bucketName),
 			Key:         aws.String(objectKey),
 			Body:        file,
 			ContentType: aws.String(contentType),
 		})
+		endSpan(span, err)
 		if err != nil {
 			log.Printf("Couldn't upload file to %v:%v. Here's why: %v\n",
 				bucketName, objectKey, err)
@@ -118,7 +157,7 @@ func UploadFile(bucketName string, objectKey string, fileName string, contentTyp
 	return err
 }
 
-func Upload(bucketName string, objectKey string, file multipart.File, contentType string) error {
+func Upload(ctx context.Context, bucketName string, objectKey string, file multipart.File, contentType string) error {
 
 	if bucketName == "" {
 		return fmt.Errorf("bucket name cannot be empty")
@@ -134,7 +173,7 @@ func Upload(bucketName string, objectKey string, file multipart.File, contentTyp
 		return fmt.Errorf("failed to seek file: %w", err)
 	}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("eu-north-1"))
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("eu-north-1"))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -142,15 +181,37 @@ func Upload(bucketName string, objectKey string, file multipart.File, contentTyp
 	// Create an S3 client from the configuration
 	client := s3.NewFromConfig(cfg)
 
-	_, err = client.PutObject(context.TODO(), &s3.PutObjectInput{
+	ctx, span := startSpan(ctx, "PutObject", bucketName, objectKey)
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(bucketName),
 		Key:         aws.String(objectKey),
 		Body:        file,
 		ContentType: aws.String(contentType),
 	})
+	endSpan(span, err)
 	if err != nil {
 		log.Printf("Couldn't upload file to %v:%v. Here's why: %v\n",
 			bucketName, objectKey, err)
 	}
 	return err
 }
+
+// HeadBucket checks the bucket exists and the configured credentials can access it
+func HeadBucket(ctx context.Context, bucket string) error {
+	if bucket == "" {
+		return fmt.Errorf("bucket name cannot be empty")
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("eu-north-1"))
+	if err != nil {
+		return fmt.Errorf("loading AWS config: %w", err)
+	}
+	client := s3.NewFromConfig(cfg)
+
+	ctx, span := startSpan(ctx, "HeadBucket", bucket, "")
+	_, err = client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	endSpan(span, err)
+	return err
+}
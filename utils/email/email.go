@@ -2,14 +2,78 @@ package email
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"net"
 	"net/smtp"
 	"os"
 	"text/template"
 	"time"
+
+	"github.com/NhyiraAmofaSekyi/go-webserver/internal/monitoring"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName = "github.com/NhyiraAmofaSekyi/go-webserver/utils/email"
+	smtpHost   = "smtp.gmail.com"
+	smtpPort   = 587
 )
 
-func SendMail(subject string, email string, body string) error {
+// send delivers msg over SMTP inside a client span and records it in the
+// email metrics under kind. smtp.SendMail takes no context, so cancelling
+// ctx does not abort a send in progress.
+func send(ctx context.Context, kind string, auth smtp.Auth, from string, to []string, msg []byte) error {
+	_, span := otel.Tracer(tracerName).Start(ctx, "smtp.send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.ServerAddress(smtpHost),
+			semconv.ServerPort(smtpPort),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+	err := smtp.SendMail(fmt.Sprintf("%s:%d", smtpHost, smtpPort), auth, from, to, msg)
+	result := "sent"
+	if err != nil {
+		result = "failed"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	monitoring.EmailsTotal.WithLabelValues(kind, result).Inc()
+	monitoring.EmailSendDuration.WithLabelValues(kind, result).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// Ping connects to the SMTP server and greets it without sending mail
+func Ping(ctx context.Context) error {
+	addr := fmt.Sprintf("%s:%d", smtpHost, smtpPort)
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, smtpHost)
+	if err != nil {
+		return fmt.Errorf("greeting %s: %w", addr, err)
+	}
+	defer client.Close()
+	if err := client.Hello("localhost"); err != nil {
+		return fmt.Errorf("greeting %s: %w", addr, err)
+	}
+	return client.Quit()
+}
+
+func SendMail(ctx context.Context, subject string, email string, body string) error {
 	password := os.Getenv("SMTP_PASSWORD")
 	emailAcc := os.Getenv("EMAILACC")
 	start := time.Now()
@@ -17,17 +81,11 @@ func SendMail(subject string, email string, body string) error {
 		"",
 		emailAcc,
 		password,
-		"smtp.gmail.com",
+		smtpHost,
 	)
 
 	msg := "Subject: " + subject + "\n" + body
-	err := smtp.SendMail(
-		"smtp.gmail.com:587",
-		auth,
-		emailAcc,
-		[]string{email},
-		[]byte(msg),
-	)
+	err := send(ctx, "text", auth, emailAcc, []string{email}, []byte(msg))
 	if err != nil {
 		return fmt.Errorf("SendMail failed: %w", err)
 	}
@@ -35,7 +93,7 @@ func SendMail(subject string, email string, body string) error {
 	fmt.Printf("SendMail done in %s\n", time.Since(start))
 	return nil
 }
-func SendHTML(subject string, email string, name string) error {
+func SendHTML(ctx context.Context, subject string, email string, name string) error {
 	password := os.Getenv("SMTP_PASSWORD")
 	emailAcc := os.Getenv("EMAILACC")
 	start := time.Now()
@@ -56,18 +114,12 @@ func SendHTML(subject string, email string, name string) error {
 		"",
 		emailAcc,
 		password, // Make sure to use an application-specific password here
-		"smtp.gmail.com",
+		smtpHost,
 	)
 
 	headers := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";"
 	msg := "Subject: " + subject + "\n" + headers + "\n\n" + body.String()
-	err = smtp.SendMail(
-		"smtp.gmail.com:587",
-		auth,
-		emailAcc,
-		[]string{email},
-		[]byte(msg),
-	)
+	err = send(ctx, "html", auth, emailAcc, []string{email}, []byte(msg))
 	if err != nil {
 		return fmt.Errorf("SendMail failed: %w", err)
 	}
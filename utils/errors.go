@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// Error codes returned in the "code" field of ErrorResponse
+const (
+	ErrCodeBadRequest           = "bad_request"
+	ErrCodeInvalidJSON          = "invalid_json"
+	ErrCodeUnauthorized         = "unauthorized"
+	ErrCodeForbidden            = "forbidden"
+	ErrCodeNotFound             = "not_found"
+	ErrCodeMethodNotAllowed     = "method_not_allowed"
+	ErrCodeConflict             = "conflict"
+	ErrCodePayloadTooLarge      = "payload_too_large"
+	ErrCodeUnsupportedMediaType = "unsupported_media_type"
+	ErrCodeUnprocessable        = "unprocessable_entity"
+	ErrCodeTooManyRequests      = "too_many_requests"
+	ErrCodeInternal             = "internal_error"
+	ErrCodeUnavailable          = "service_unavailable"
+)
+
+// DefaultMaxJSONBytes limits request bodies read by DecodeJSON
+const DefaultMaxJSONBytes = 1 << 20
+
+// ErrorResponse is the body of every error returned by the API
+type ErrorResponse struct {
+	Error     string `json:"error"`                // human readable message
+	Code      string `json:"code"`                 // machine readable code, see ErrCode*
+	RequestID string `json:"request_id,omitempty"` // X-Request-ID of the request, if any
+}
+
+// ErrorCode returns the default error code for an HTTP status
+func ErrorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrCodeBadRequest
+	case http.StatusUnauthorized:
+		return ErrCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrCodeForbidden
+	case http.StatusNotFound:
+		return ErrCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrCodeMethodNotAllowed
+	case http.StatusConflict:
+		return ErrCodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return ErrCodePayloadTooLarge
+	case http.StatusUnsupportedMediaType:
+		return ErrCodeUnsupportedMediaType
+	case http.StatusUnprocessableEntity:
+		return ErrCodeUnprocessable
+	case http.StatusTooManyRequests:
+		return ErrCodeTooManyRequests
+	case http.StatusServiceUnavailable:
+		return ErrCodeUnavailable
+	}
+	if status > 499 {
+		return ErrCodeInternal
+	}
+	return ErrCodeBadRequest
+}
+
+// APIError is an error that knows how it should be reported to the client
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// RespondWithAPIError writes err in the error envelope, errors that are not
+// an *APIError are reported as a 500 without exposing their message
+func RespondWithAPIError(w http.ResponseWriter, err error) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		RespondWithErrorCode(w, apiErr.Status, apiErr.Code, apiErr.Message)
+		return
+	}
+	RespondWithErrorCode(w, http.StatusInternalServerError, ErrCodeInternal, "internal server error")
+}
+
+// DecodeJSON reads a single JSON value from the request body into dst. A
+// Content-Type other than application/json is rejected with 415 and bodies
+// over DefaultMaxJSONBytes with 413; malformed JSON gives a 400 naming the
+// problem. The returned error is an *APIError for RespondWithAPIError.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != "application/json" {
+			return &APIError{http.StatusUnsupportedMediaType, ErrCodeUnsupportedMediaType, "Content-Type must be application/json"}
+		}
+	}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, DefaultMaxJSONBytes))
+	if err := decoder.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return &APIError{http.StatusBadRequest, ErrCodeInvalidJSON, "request body must contain a single JSON value"}
+	}
+	return nil
+}
+
+func decodeError(err error) *APIError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return &APIError{http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, fmt.Sprintf("request body must not be larger than %d bytes", maxBytesErr.Limit)}
+	case errors.As(err, &syntaxErr):
+		return &APIError{http.StatusBadRequest, ErrCodeInvalidJSON, fmt.Sprintf("malformed JSON at position %d", syntaxErr.Offset)}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &APIError{http.StatusBadRequest, ErrCodeInvalidJSON, "malformed JSON"}
+	case errors.As(err, &typeErr):
+		if typeErr.Field != "" {
+			return &APIError{http.StatusBadRequest, ErrCodeInvalidJSON, fmt.Sprintf("field %q must be of type %s", typeErr.Field, typeErr.Type)}
+		}
+		return &APIError{http.StatusBadRequest, ErrCodeInvalidJSON, fmt.Sprintf("request body must be of type %s", typeErr.Type)}
+	case errors.Is(err, io.EOF):
+		return &APIError{http.StatusBadRequest, ErrCodeInvalidJSON, "request body must not be empty"}
+	}
+	return &APIError{http.StatusBadRequest, ErrCodeInvalidJSON, "invalid JSON body"}
+}
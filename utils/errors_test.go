@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	type parameters struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+
+	tests := []struct {
+		name           string
+		contentType    string
+		body           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "Valid Body", contentType: "application/json", body: `{"name":"ama","age":3}`},
+		{name: "Valid Body With Charset", contentType: "application/json; charset=utf-8", body: `{"name":"ama"}`},
+		{name: "Missing Content Type", body: `{"name":"ama"}`},
+		{
+			name:           "Wrong Content Type",
+			contentType:    "text/plain",
+			body:           `{"name":"ama"}`,
+			expectedStatus: http.StatusUnsupportedMediaType,
+			expectedCode:   ErrCodeUnsupportedMediaType,
+		},
+		{
+			name:           "Malformed JSON",
+			contentType:    "application/json",
+			body:           `{"name":}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidJSON,
+		},
+		{
+			name:           "Truncated JSON",
+			contentType:    "application/json",
+			body:           `{"name":"ama"`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidJSON,
+		},
+		{
+			name:           "Wrong Field Type",
+			contentType:    "application/json",
+			body:           `{"age":"three"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidJSON,
+		},
+		{
+			name:           "Empty Body",
+			contentType:    "application/json",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidJSON,
+		},
+		{
+			name:           "Trailing Data",
+			contentType:    "application/json",
+			body:           `{"name":"ama"}{"name":"kofi"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidJSON,
+		},
+		{
+			name:           "Body Too Large",
+			contentType:    "application/json",
+			body:           `{"name":"` + strings.Repeat("a", DefaultMaxJSONBytes) + `"}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedCode:   ErrCodePayloadTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/test", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+
+			var params parameters
+			err := DecodeJSON(rr, req, &params)
+			if tt.expectedStatus == 0 {
+				if err != nil {
+					t.Fatalf("DecodeJSON returned error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+
+			RespondWithAPIError(rr, err)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			var response ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Could not decode response body: %v", err)
+			}
+			if response.Code != tt.expectedCode {
+				t.Errorf("handler returned unexpected error code: got %v want %v", response.Code, tt.expectedCode)
+			}
+		})
+	}
+}
+
+func TestRespondWithAPIErrorHidesInternalErrors(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rr.Header().Set("X-Request-ID", "req-1")
+	RespondWithAPIError(rr, http.ErrHandlerTimeout)
+
+	var response ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Could not decode response body: %v", err)
+	}
+	if rr.Code != http.StatusInternalServerError || response.Code != ErrCodeInternal {
+		t.Errorf("unexpected response: %d %+v", rr.Code, response)
+	}
+	if strings.Contains(response.Error, http.ErrHandlerTimeout.Error()) {
+		t.Error("internal error message leaked to the client")
+	}
+	if response.RequestID != "req-1" {
+		t.Errorf("wrong request ID: got %q want %q", response.RequestID, "req-1")
+	}
+}
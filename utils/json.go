@@ -11,17 +11,45 @@ type ReqTime string
 
 const ReqStartTime ReqTime = "reqStartTime"
 
-func RespondWithError(w http.ResponseWriter, code int, msg string) {
+// ErrorAnnotator is implemented by response writers that report and log the
+// message of a 5xx response themselves, such as the error reporting middleware
+type ErrorAnnotator interface {
+	AnnotateError(message string)
+}
 
-	if code > 499 {
-		logger.Error("Responding with 5XX error: %s", msg)
+// annotateError passes msg to the ErrorAnnotator wrapped by w, if any, and
+// reports whether there was one
+func annotateError(w http.ResponseWriter, msg string) bool {
+	for w != nil {
+		if a, ok := w.(ErrorAnnotator); ok {
+			a.AnnotateError(msg)
+			return true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
 	}
-	type errResponse struct {
-		Error string `json:"error"`
+	return false
+}
+
+// RespondWithError writes the error envelope with the code matching the status
+func RespondWithError(w http.ResponseWriter, code int, msg string) {
+	RespondWithErrorCode(w, code, ErrorCode(code), msg)
+}
+
+// RespondWithErrorCode writes the error envelope with a specific error code
+func RespondWithErrorCode(w http.ResponseWriter, status int, code, msg string) {
+
+	if status > 499 && !annotateError(w, msg) {
+		logger.Error("Responding with 5XX error: " + msg)
 	}
 
-	RespondWithJSON(w, code, errResponse{
-		Error: msg,
+	RespondWithJSON(w, status, ErrorResponse{
+		Error:     msg,
+		Code:      code,
+		RequestID: w.Header().Get("X-Request-ID"),
 	})
 }
 
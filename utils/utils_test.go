@@ -19,25 +19,28 @@ func TestMain(m *testing.M) {
 // TestRespondWithError tests the error response functionality
 func TestRespondWithError(t *testing.T) {
 	tests := []struct {
-		name          string
-		code          int
-		message       string
-		expectedCode  int
-		expectedError string
+		name            string
+		code            int
+		message         string
+		expectedCode    int
+		expectedError   string
+		expectedErrCode string
 	}{
 		{
-			name:          "Client Error",
-			code:          http.StatusBadRequest,
-			message:       "Invalid request",
-			expectedCode:  http.StatusBadRequest,
-			expectedError: "Invalid request",
+			name:            "Client Error",
+			code:            http.StatusBadRequest,
+			message:         "Invalid request",
+			expectedCode:    http.StatusBadRequest,
+			expectedError:   "Invalid request",
+			expectedErrCode: ErrCodeBadRequest,
 		},
 		{
-			name:          "Server Error",
-			code:          http.StatusInternalServerError,
-			message:       "Internal server error",
-			expectedCode:  http.StatusInternalServerError,
-			expectedError: "Internal server error",
+			name:            "Server Error",
+			code:            http.StatusInternalServerError,
+			message:         "Internal server error",
+			expectedCode:    http.StatusInternalServerError,
+			expectedError:   "Internal server error",
+			expectedErrCode: ErrCodeInternal,
 		},
 	}
 
@@ -63,9 +66,7 @@ func TestRespondWithError(t *testing.T) {
 			}
 
 			// Check response body
-			var response struct {
-				Error string `json:"error"`
-			}
+			var response ErrorResponse
 			err := json.NewDecoder(rr.Body).Decode(&response)
 			if err != nil {
 				t.Fatalf("Could not decode response body: %v", err)
@@ -75,6 +76,10 @@ func TestRespondWithError(t *testing.T) {
 				t.Errorf("handler returned unexpected error message: got %v want %v",
 					response.Error, tt.expectedError)
 			}
+			if response.Code != tt.expectedErrCode {
+				t.Errorf("handler returned unexpected error code: got %v want %v",
+					response.Code, tt.expectedErrCode)
+			}
 		})
 	}
 }